@@ -2,23 +2,28 @@ package api
 
 import (
 	"bytes"
-	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"math/big"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"smartley-contracts/blockchain"
 	"smartley-contracts/contracts"
+	"smartley-contracts/disasm"
 
 	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
-	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
@@ -33,20 +38,6 @@ type executeContractRequest struct {
 
 var ExecutionEnvironments map[string]*contracts.VMExecutionEnvironment
 
-func generateContractAddress() string {
-	// Create a new random UUID
-	newUUID, err := uuid.NewRandom()
-	if err != nil {
-		log.Fatalf("Failed to generate UUID: %v", err)
-	}
-
-	// Generate a hash of the UUID
-	hash := sha256.Sum256([]byte(newUUID.String()))
-
-	// Return the first 20 bytes of the hash as a hex-encoded string
-	return hex.EncodeToString(hash[:20])
-}
-
 func createContract(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
@@ -54,8 +45,10 @@ func createContract(w http.ResponseWriter, r *http.Request) {
 	}
 
 	type soliditySource struct {
-		Source            string `json:"source"`
-		RicardianContract string `json:"ricardianContract"`
+		Source            string   `json:"source"`
+		RicardianContract string   `json:"ricardianContract"`
+		ConstructorArgs   []string `json:"constructorArgs,omitempty"` // Constructor arguments, as in /contracts/{id}/execute
+		ContractName      string   `json:"contractName,omitempty"`    // Contract to deploy, if the source defines several
 	}
 
 	body, err := ioutil.ReadAll(r.Body)
@@ -72,62 +65,48 @@ func createContract(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Compile the Solidity contract code into bytecode and ABI
-	abiBytes, bytecode, err := contracts.CompileSoliditySource(sourceObj.Source)
+	compiled, err := contracts.CompileSoliditySource(sourceObj.Source, sourceObj.ContractName)
 	if err != nil {
 		log.Println("Error compiling Solidity code:", err)
-		http.Error(w, "Error compiling Solidity code", http.StatusInternalServerError)
+		http.Error(w, "Error compiling Solidity code: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	// Remove metadata from the bytecode
-	cleanedBytecode := removeMetadata(bytecode)
+	cleanedBytecode := removeMetadata(compiled.Bytecode)
 
 	log.Println("Cleaned Bytecode:", cleanedBytecode)
 
 	// Create a new Contract instance
 	contract := &contracts.Contract{
-		SoliditySource: sourceObj.Source,
-		CreatedAt:      time.Now(),
-		UpdatedAt:      time.Now(),
-		Name:           "Contract Name",
-		Source:         "Solidity",
-		Bytecode:       cleanedBytecode,
-		ABI:            abiBytes,
+		SoliditySource:  sourceObj.Source,
+		CreatedAt:       time.Now(),
+		UpdatedAt:       time.Now(),
+		Name:            compiled.Name,
+		Source:          "Solidity",
+		Bytecode:        cleanedBytecode,
+		ABI:             compiled.ABI,
+		ConstructorArgs: sourceObj.ConstructorArgs,
 	}
 
-	// Generate and set the Ricardian contract
-	contract.RicardianContract = generateRicardianContract(contract)
-
-	// Generate a contract address and set it
-	contract.Address = generateContractAddress()
-
-	// Set the contract ID to its address
-	contract.ID = contract.Address
-
-	// Save the contract to the database and deploy it to the blockchain
+	// Deploy the contract to the blockchain, which sets its address, and save
+	// it to the database under that address. The deployment is mined into a
+	// block of its own, so the request waits for its proof of work.
 	_, err = contracts.CreateContract(contract, blockchain.BlockchainInstance)
 	if err != nil {
 		log.Println("Error creating and deploying the contract:", err)
-		http.Error(w, "Error creating and deploying the contract", http.StatusInternalServerError)
+		http.Error(w, "Error creating and deploying the contract: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Add the contract to the blockchain
-	contractTransaction := &blockchain.Transaction{
-		Sender:    "0",
-		Recipient: contract.Address,
-		Payload:   "",
-		Contract:  []byte(contract.Bytecode),
+	// Generate and set the Ricardian contract, which quotes the address
+	contract.RicardianContract = generateRicardianContract(contract)
+	if _, err := contracts.UpdateContract(contract); err != nil {
+		log.Println("Error saving the Ricardian contract:", err)
 	}
 
-	blockchain.BlockchainInstance.AddTransaction(contractTransaction)
-	blockchain.BlockchainInstance.AddBlock()
-
-	// Create a new VMExecutionEnvironment for the contract
-	env := contracts.NewVMExecutionEnvironment(contract)
-
-	// Store the VMExecutionEnvironment in the ExecutionEnvironments map
-	ExecutionEnvironments[contract.ID] = env
+	// Store the contract's VMExecutionEnvironment in the ExecutionEnvironments map
+	ExecutionEnvironments[contract.ID] = newExecutionEnvironment(contract)
 
 	// Respond with the created contract as JSON
 	respJSON, err := json.Marshal(contract)
@@ -141,6 +120,17 @@ func createContract(w http.ResponseWriter, r *http.Request) {
 	w.Write(respJSON)
 }
 
+// newExecutionEnvironment creates the VMExecutionEnvironment that runs calls
+// to a deployed contract's runtime code. The calls run against the chain's
+// state, which decodeContractCall sets.
+func newExecutionEnvironment(contract *contracts.Contract) *contracts.VMExecutionEnvironment {
+	env := contracts.NewVMExecutionEnvironment(contract)
+	if deployed, ok := bc.State()[common.HexToAddress(contract.Address)]; ok {
+		env.Bytecode = deployed.GetBytecode()
+	}
+	return env
+}
+
 // removeMetadata searches for the Solidity contract metadata start sequence and removes it from the bytecode
 func removeMetadata(bytecode string) string {
 	metadataStart := "a165627a7a72305820"
@@ -226,8 +216,21 @@ func rootHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-func executeContractFunction(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("executeContractFunction called")
+// contractCall is a call to a contract function, as decoded from the body of
+// a request to one of the /contracts/{id} endpoints.
+type contractCall struct {
+	address  string
+	env      *contracts.VMExecutionEnvironment
+	method   abi.Method
+	args     []interface{}
+	simulate bool
+}
+
+// decodeContractCall reads the call described by a request's body and sets up
+// the contract's environment to run it in the context of the latest block,
+// against the chain's state. On
+// failure it writes the error response itself and returns false.
+func decodeContractCall(w http.ResponseWriter, r *http.Request) (*contractCall, bool) {
 	vars := mux.Vars(r)
 	contractAddress := vars["id"] // Use contractAddress instead of contractID
 
@@ -235,80 +238,138 @@ func executeContractFunction(w http.ResponseWriter, r *http.Request) {
 	env, ok := ExecutionEnvironments[contractAddress]
 	if !ok {
 		http.Error(w, "VMExecutionEnvironment not found for contract", http.StatusNotFound)
-		return
+		return nil, false
 	}
 
 	// Read the JSON body containing the functionSignature
 	var requestBody struct {
 		FunctionSignature string   `json:"functionSignature"`
 		Args              []string `json:"args,omitempty"`
+		From              string   `json:"from,omitempty"`     // Caller address, msg.sender, of a call that only reads state
+		Value             string   `json:"value,omitempty"`    // Wei sent with the call, in decimal
+		Simulate          bool     `json:"simulate,omitempty"` // Discard the call's state changes, as view and pure calls always do
 	}
 	err := json.NewDecoder(r.Body).Decode(&requestBody)
 	if err != nil {
 		http.Error(w, "Error decoding request body", http.StatusBadRequest)
-		return
+		return nil, false
 	}
 
 	functionSignature := requestBody.FunctionSignature
 	if functionSignature == "" {
 		http.Error(w, "Missing 'functionSignature' in request body", http.StatusBadRequest)
-		return
+		return nil, false
 	}
 
 	parsedAbi, err := abi.JSON(bytes.NewReader(env.ABI))
 	if err != nil {
 		http.Error(w, "Error parsing contract ABI", http.StatusInternalServerError)
-		return
+		return nil, false
 	}
 
 	method, ok := parsedAbi.Methods[functionSignature]
 	if !ok {
 		http.Error(w, "Function signature not found in ABI", http.StatusBadRequest)
-		return
+		return nil, false
 	}
 
-	args := make([]interface{}, len(requestBody.Args))
-	for i, arg := range requestBody.Args {
-		argType := method.Inputs[i].Type
-
-		var typedArg interface{}
-		switch argType.T {
-		case abi.IntTy, abi.UintTy:
-			bigIntValue, ok := new(big.Int).SetString(arg, 10)
-			if !ok {
-				http.Error(w, "Error converting string to big.Int", http.StatusBadRequest)
-				return
-			}
-			typedArg = bigIntValue
-		case abi.StringTy:
-			typedArg = arg
-		case abi.BytesTy:
-			bytesArg, err := hexutil.Decode(arg)
-			if err != nil {
-				http.Error(w, "Error decoding hex string to bytes", http.StatusBadRequest)
-				return
-			}
-			typedArg = bytesArg
-		default:
-			http.Error(w, "Unsupported argument type", http.StatusBadRequest)
-			return
-		}
+	args, err := contracts.ParseArgs(method.Inputs, requestBody.Args)
+	if err != nil {
+		http.Error(w, "Error converting arguments: "+err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
 
-		args[i] = typedArg
+	// Run the call in the context of the latest block
+	value := new(big.Int)
+	if requestBody.Value != "" {
+		if _, ok := value.SetString(requestBody.Value, 10); !ok {
+			http.Error(w, "Error converting value to big.Int", http.StatusBadRequest)
+			return nil, false
+		}
 	}
+	env.Context = bc.ExecutionContext(&blockchain.Transaction{
+		Sender:    requestBody.From,
+		Recipient: contractAddress,
+		Value:     value,
+	}, bc.LastBlock())
+
+	// Run against the chain's accounts, so that the call sees the same state
+	// as mined transactions and any other contract it calls
+	env.State = contracts.NewStateDB(bc.State())
+
+	return &contractCall{
+		address:  contractAddress,
+		env:      env,
+		method:   method,
+		args:     args,
+		simulate: requestBody.Simulate,
+	}, true
+}
 
-	// Execute the contract function
-	result, err := env.ExecuteWithArgs(functionSignature, args)
+func executeContractFunction(w http.ResponseWriter, r *http.Request) {
+	call, ok := decodeContractCall(w, r)
+	if !ok {
+		return
+	}
+	env, contractAddress, functionSignature, args := call.env, call.address, call.method.Name, call.args
+
+	// Calls made here are not signed, so the caller named by "from" cannot be
+	// trusted. They may only read state: calls to view and pure functions, and
+	// calls the client asks to simulate. Anything else must be sent as a
+	// signed transaction.
+	simulated := call.simulate || call.method.IsConstant()
+	if !simulated {
+		http.Error(w, "Calls that change state must be sent as signed transactions to /transactions/raw or /transactions/new; set 'simulate' to run the call without changing state", http.StatusBadRequest)
+		return
+	}
+	result, err := env.Simulate(functionSignature, args)
 
 	if err != nil {
-		log.Printf("Error executing contract function: %v\nFunction signature: %s\nArgs: %v\n", err, functionSignature, requestBody.Args)
+		log.Printf("Error executing contract function: %v\nFunction signature: %s\nArgs: %v\n", err, functionSignature, args)
+
+		// A revert is a contract-level rejection of the call, not a server
+		// failure, so report it to the client with the decoded reason.
+		// Point at the Solidity line that failed, when it can be found
+		location := failureLocation(contractAddress, env.Bytecode, err)
+		if location != nil {
+			log.Printf("Failed at %s: %s\n", location, location.Snippet)
+		}
+
+		var revertErr *contracts.RevertError
+		if errors.As(err, &revertErr) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":   revertErr.Error(),
+				"revert":  revertErr,
+				"gasUsed": result.GasUsed,
+				"source":  location,
+			})
+			return
+		}
+
+		// Running out of gas means the caller's limit was too low for the call
+		if errors.Is(err, contracts.ErrOutOfGas) || errors.Is(err, contracts.ErrIntrinsicGas) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":   err.Error(),
+				"gasUsed": result.GasUsed,
+				"source":  location,
+			})
+			return
+		}
+
 		http.Error(w, "Error executing contract function", http.StatusInternalServerError)
 		return
 	}
 
 	// Respond with the execution result
 	respJSON, err := json.Marshal(map[string]interface{}{
-		"result": result,
+		"result":    result.ReturnValue,
+		"gasUsed":   result.GasUsed,
+		"logs":      result.Logs,
+		"simulated": simulated,
 	})
 	if err != nil {
 		http.Error(w, "Error marshaling execution result", http.StatusInternalServerError)
@@ -319,17 +380,127 @@ func executeContractFunction(w http.ResponseWriter, r *http.Request) {
 	w.Write(respJSON)
 }
 
+// estimateGas reports the lowest gas limit with which a call to a contract
+// function succeeds, or why the call fails with any limit. The call is only
+// simulated; it never changes the contract's state.
+func estimateGas(w http.ResponseWriter, r *http.Request) {
+	call, ok := decodeContractCall(w, r)
+	if !ok {
+		return
+	}
+
+	gas, err := call.env.EstimateGas(call.method.Name, call.args)
+	if err != nil {
+		log.Printf("Error estimating gas: %v\nFunction signature: %s\nArgs: %v\n", err, call.method.Name, call.args)
+
+		// The call cannot succeed, which is an answer rather than a server failure
+		response := map[string]interface{}{
+			"error":  err.Error(),
+			"source": failureLocation(call.address, call.env.Bytecode, err),
+		}
+		var revertErr *contracts.RevertError
+		if errors.As(err, &revertErr) {
+			response["revert"] = revertErr
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"gas": gas,
+	})
+}
+
+// failureLocation maps the instruction at which a call to a contract's runtime
+// code failed back to the contract's Solidity source. It returns nil if the
+// error does not come from the contract's own code or the contract was saved
+// without a source map.
+func failureLocation(contractID string, code []byte, err error) *disasm.Location {
+	var execErr *contracts.ExecutionError
+	if !errors.As(err, &execErr) {
+		return nil
+	}
+	contract, err := contracts.GetContract(contractID)
+	if err != nil {
+		return nil
+	}
+	sourceMap, err := disasm.ParseSourceMap(contract.DeployedSourceMap)
+	if err != nil {
+		log.Printf("Invalid source map for contract %s: %v", contractID, err)
+		return nil
+	}
+	location, err := sourceMap.Locate(code, execErr.PC, contractSources(contract))
+	if err != nil {
+		return nil
+	}
+	return location
+}
+
+// contractSources returns the files a contract's source maps refer to.
+func contractSources(contract *contracts.Contract) []disasm.Source {
+	return []disasm.Source{{Name: contracts.SourceName, Content: contract.SoliditySource}}
+}
+
+// getDisassembly renders a contract's code as annotated instructions, with the
+// Solidity location of each one when the contract has a source map. It shows
+// the creation bytecode the contract was saved with, or with ?runtime=true the
+// code deployed on the chain.
+func getDisassembly(w http.ResponseWriter, r *http.Request) {
+	contract, err := contracts.GetContract(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Error retrieving contract", http.StatusInternalServerError)
+		return
+	}
+
+	var code []byte
+	sourceMapText := contract.SourceMap
+	if runtime, _ := strconv.ParseBool(r.URL.Query().Get("runtime")); runtime {
+		account, ok := bc.State()[common.HexToAddress(contract.Address)]
+		if !ok {
+			http.Error(w, "Contract is not deployed", http.StatusNotFound)
+			return
+		}
+		code = account.GetBytecode()
+		sourceMapText = contract.DeployedSourceMap
+	} else if code, err = hex.DecodeString(strings.TrimPrefix(contract.Bytecode, "0x")); err != nil {
+		http.Error(w, "Contract bytecode is not valid hex", http.StatusInternalServerError)
+		return
+	}
+
+	sourceMap, err := disasm.ParseSourceMap(sourceMapText)
+	if err != nil {
+		log.Printf("Invalid source map for contract %s: %v", contract.ID, err)
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(disasm.Format(code, sourceMap, contractSources(contract))))
+}
+
 func routes(bc *blockchain.Blockchain) *mux.Router {
 	router := mux.NewRouter().StrictSlash(false)
 	router.HandleFunc("/", rootHandler).Methods("GET")
 	router.HandleFunc("/contracts", createContract).Methods("POST")
 	router.HandleFunc("/contracts/{id}", getContractByID).Methods("GET")
 	router.HandleFunc("/contracts/{id}/execute", executeContractFunction).Methods("POST")
+	router.HandleFunc("/contracts/{id}/estimate-gas", estimateGas).Methods("POST")
 	router.HandleFunc("/contracts", getContracts).Methods("GET")
 	router.HandleFunc("/chain", getChainHandler).Methods("GET")
 	router.HandleFunc("/transactions/new", createTransaction).Methods("POST")
+	router.HandleFunc("/transactions/raw", createRawTransaction).Methods("POST")
+	router.HandleFunc("/transactions/{hash}", getTransaction).Methods("GET")
 	router.HandleFunc("/mine", mineHandler).Methods("GET")
+	router.HandleFunc("/blocks/{index}/receipts", getBlockReceipts).Methods("GET")
+	router.HandleFunc("/blocks/{index}/transactions/{tx}/trace", traceTransaction).Methods("POST")
+	router.HandleFunc("/blocks/{index}/transactions/{tx}/proof", getTransactionProof).Methods("GET")
+	router.HandleFunc("/blocks/{index}/receipts/{tx}/proof", getReceiptProof).Methods("GET")
+	router.HandleFunc("/proofs/verify", verifyInclusionProof).Methods("POST")
+	router.HandleFunc("/accounts/{address}", getAccount).Methods("GET")
 	router.HandleFunc("/contracts/{id}/ricardian", getRicardianContractByID).Methods("GET")
+	router.HandleFunc("/contracts/{id}/disassembly", getDisassembly).Methods("GET")
+	router.HandleFunc("/admin/validate", requireAdmin(validateChain)).Methods("POST")
 
 	return router
 }
@@ -344,9 +515,10 @@ func getChainHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data := map[string]interface{}{
-		"chain":     bc.Chain(),
-		"length":    len(bc.Chain()),
-		"contracts": allContracts,
+		"chain":            bc.Chain(),
+		"length":           len(bc.Chain()),
+		"total_difficulty": bc.TotalDifficulty(),
+		"contracts":        allContracts,
 	}
 	json.NewEncoder(w).Encode(data)
 }
@@ -376,20 +548,247 @@ func createTransaction(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	bc.AddTransaction(&transaction)
+	submitTransaction(w, &transaction)
+}
+
+// createRawTransaction accepts a transaction in its canonical encoding, as
+// produced by Ethereum tooling: {"raw": "0x..."}.
+func createRawTransaction(w http.ResponseWriter, r *http.Request) {
+	var requestBody struct {
+		Raw hexutil.Bytes `json:"raw"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, "Error decoding request body", http.StatusBadRequest)
+		return
+	}
+
+	transaction, err := blockchain.DecodeTransaction(requestBody.Raw)
+	if err != nil {
+		http.Error(w, "Invalid transaction: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	submitTransaction(w, transaction)
+}
+
+// submitTransaction adds a transaction to the pool and responds with it and
+// its hash, by which it can be looked up.
+func submitTransaction(w http.ResponseWriter, transaction *blockchain.Transaction) {
+	// Only transactions signed by their sender are accepted
+	if err := bc.AddTransaction(transaction); err != nil {
+		http.Error(w, "Invalid transaction: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	hash, err := transaction.Hash()
+	if err != nil {
+		http.Error(w, "Error hashing transaction", http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(transaction)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"hash":        hash,
+		"transaction": transaction,
+	})
+}
+
+// getTransaction looks up a transaction by hash. Mined transactions are
+// reported with their block and receipt, pooled ones as pending.
+func getTransaction(w http.ResponseWriter, r *http.Request) {
+	hash, err := hexutil.Decode(mux.Vars(r)["hash"])
+	if err != nil || len(hash) != common.HashLength {
+		http.Error(w, "Invalid transaction hash", http.StatusBadRequest)
+		return
+	}
+
+	transaction, receipt, block := bc.GetTransaction(common.BytesToHash(hash))
+	if transaction == nil {
+		http.Error(w, "Transaction not found", http.StatusNotFound)
+		return
+	}
+	response := map[string]interface{}{
+		"hash":        common.BytesToHash(hash),
+		"transaction": transaction,
+		"pending":     block == nil,
+	}
+	if block != nil {
+		response["block_index"] = block.Index
+		response["receipt"] = receipt
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
 }
 
+// mining is held while a block requested through /mine is mined.
+var mining sync.Mutex
+
+// mineHandler starts mining the pooled transactions into a new block and
+// responds without waiting for the proof of work, which takes about one block
+// interval. The block appears in /chain once it is found. Requests made while
+// a block is being mined are refused rather than queued.
 func mineHandler(w http.ResponseWriter, r *http.Request) {
-	bc.AddBlock()
-	lastBlock := bc.LastBlock()
+	if !mining.TryLock() {
+		http.Error(w, "A block is already being mined", http.StatusConflict)
+		return
+	}
+	go func() {
+		defer mining.Unlock()
+		bc.AddBlock()
+	}()
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(http.StatusAccepted)
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message": "New Block Forged",
-		"block":   lastBlock,
+		"message": "Mining a new block",
+	})
+}
+
+func getBlockReceipts(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	index, err := strconv.Atoi(vars["index"])
+	if err != nil {
+		http.Error(w, "Invalid block index", http.StatusBadRequest)
+		return
+	}
+
+	chain := bc.Chain()
+	if index < 1 || index > len(chain) {
+		http.Error(w, "Block not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(chain[index-1].Receipts)
+}
+
+// traceTransaction replays a mined transaction with a tracer and responds with
+// the trace, in the format of geth's debug_traceTransaction. The optional body
+// selects the tracer: {"tracer": "callTracer"} for the call tree, or the
+// default struct logger configured with the options of contracts.LogConfig.
+func traceTransaction(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	index, err := strconv.Atoi(vars["index"])
+	if err != nil {
+		http.Error(w, "Invalid block index", http.StatusBadRequest)
+		return
+	}
+	txIndex, err := strconv.Atoi(vars["tx"])
+	if err != nil {
+		http.Error(w, "Invalid transaction index", http.StatusBadRequest)
+		return
+	}
+
+	var config struct {
+		Tracer string `json:"tracer"`
+		contracts.LogConfig
+	}
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil && err != io.EOF {
+		http.Error(w, "Error decoding request body", http.StatusBadRequest)
+		return
+	}
+
+	var tracer contracts.Tracer
+	var result func() interface{}
+	switch config.Tracer {
+	case "":
+		logger := contracts.NewStructLogger(&config.LogConfig)
+		tracer, result = logger, func() interface{} { return logger.Result() }
+	case "callTracer":
+		callTracer := contracts.NewCallTracer()
+		tracer, result = callTracer, func() interface{} { return callTracer.Result() }
+	default:
+		http.Error(w, "Unknown tracer: "+config.Tracer, http.StatusBadRequest)
+		return
+	}
+
+	if _, err := bc.TraceTransaction(index, txIndex, tracer); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result())
+}
+
+// getTransactionProof responds with the proof that a transaction was recorded
+// in a block, which /proofs/verify or blockchain.InclusionProof.Verify can
+// check against the block's hash alone.
+func getTransactionProof(w http.ResponseWriter, r *http.Request) {
+	writeInclusionProof(w, r, bc.ProveTransaction)
+}
+
+// getReceiptProof responds with the proof that a transaction's receipt was
+// recorded in a block.
+func getReceiptProof(w http.ResponseWriter, r *http.Request) {
+	writeInclusionProof(w, r, bc.ProveReceipt)
+}
+
+// writeInclusionProof responds with the proof prove returns for the block and
+// transaction indexes in the request path, along with the block's hash.
+func writeInclusionProof(w http.ResponseWriter, r *http.Request, prove func(blockIndex, txIndex int) (*blockchain.InclusionProof, error)) {
+	vars := mux.Vars(r)
+	index, err := strconv.Atoi(vars["index"])
+	if err != nil {
+		http.Error(w, "Invalid block index", http.StatusBadRequest)
+		return
+	}
+	txIndex, err := strconv.Atoi(vars["tx"])
+	if err != nil {
+		http.Error(w, "Invalid transaction index", http.StatusBadRequest)
+		return
+	}
+
+	proof, err := prove(index, txIndex)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"block_hash": bc.Hash(bc.Chain()[index-1]),
+		"proof":      proof,
+	})
+}
+
+// verifyInclusionProof checks an inclusion proof against a block hash given
+// by the client, without consulting the chain: {"block_hash": ..., "proof": ...}.
+func verifyInclusionProof(w http.ResponseWriter, r *http.Request) {
+	var requestBody struct {
+		BlockHash string                     `json:"block_hash"`
+		Proof     *blockchain.InclusionProof `json:"proof"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil || requestBody.Proof == nil {
+		http.Error(w, "Error decoding request body", http.StatusBadRequest)
+		return
+	}
+
+	response := map[string]interface{}{"valid": true}
+	if err := requestBody.Proof.Verify(requestBody.BlockHash); err != nil {
+		response = map[string]interface{}{"valid": false, "error": err.Error()}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// getAccount reports the balance, nonce and code of an account. Accounts the
+// chain has never seen are reported as empty.
+func getAccount(w http.ResponseWriter, r *http.Request) {
+	address := blockchain.AddressFromString(mux.Vars(r)["address"])
+
+	balance, nonce, code := "0", uint64(0), hexutil.Bytes{}
+	if account, ok := bc.State()[address]; ok {
+		balance = account.GetBalance().Dec()
+		nonce = account.GetNonce()
+		code = account.GetBytecode()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"address": address,
+		"balance": balance,
+		"nonce":   nonce,
+		"code":    code,
 	})
 }
 
@@ -408,3 +807,42 @@ func getRicardianContractByID(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/plain")
 	w.Write([]byte(contract.RicardianContract))
 }
+
+// requireAdmin only lets requests bearing AdminToken through to next.
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if AdminToken == "" {
+			http.Error(w, "Admin endpoints are disabled; start the node with an admin token", http.StatusForbidden)
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(AdminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Invalid admin token", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// validating is held while the chain is being validated.
+var validating sync.Mutex
+
+// validateChain audits the whole chain and responds with the report, which
+// names the first block that fails validation, if any. Validation re-executes
+// every transaction, so only one runs at a time.
+func validateChain(w http.ResponseWriter, r *http.Request) {
+	if !validating.TryLock() {
+		http.Error(w, "The chain is already being validated", http.StatusTooManyRequests)
+		return
+	}
+	defer validating.Unlock()
+
+	report := bc.ValidateChain()
+	if !report.Valid {
+		log.Printf("Chain validation failed: %v", report.Failure)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,231 @@
+package api
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"smartley-contracts/blockchain"
+	"smartley-contracts/contracts"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// answerABI describes a contract with a single view function returning a number.
+const answerABI = `[{"type":"function","name":"answer","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"uint256"}]}]`
+
+// newTestChain creates a chain for the handlers to serve.
+func newTestChain(t *testing.T) *blockchain.Blockchain {
+	t.Helper()
+	bc = blockchain.NewBlockchain()
+	blockchain.BlockchainInstance = &blockchain.BlockchainWrapper{Blockchain: bc}
+	ExecutionEnvironments = make(map[string]*contracts.VMExecutionEnvironment)
+	return bc
+}
+
+// deployRuntime deploys a contract whose init code returns runtime, and makes
+// it callable through the API as the API's own deployments are.
+func deployRuntime(t *testing.T, runtime []byte) *contracts.Contract {
+	t.Helper()
+
+	// PUSH1 len, DUP1, PUSH1 9, PUSH0, CODECOPY, PUSH0, RETURN, then the
+	// runtime code
+	initCode := append([]byte{0x60, byte(len(runtime)), 0x80, 0x60, 0x09, 0x5f, 0x39, 0x5f, 0xf3}, runtime...)
+	contract := &contracts.Contract{
+		Bytecode: hex.EncodeToString(initCode),
+		ABI:      []byte(answerABI),
+	}
+	if err := blockchain.BlockchainInstance.DeployContract(contract); err != nil {
+		t.Fatalf("deployment failed: %v", err)
+	}
+	contract.ID = contract.Address
+	ExecutionEnvironments[contract.ID] = newExecutionEnvironment(contract)
+	return contract
+}
+
+// TestExecuteCrossContractCall calls a contract through the API that reads its
+// answer from another deployed contract.
+func TestExecuteCrossContractCall(t *testing.T) {
+	chain := newTestChain(t)
+
+	// The callee returns 42
+	callee := deployRuntime(t, []byte{0x60, 0x2a, 0x5f, 0x52, 0x60, 0x20, 0x5f, 0xf3}) // PUSH1 42, PUSH0, MSTORE, PUSH1 32, PUSH0, RETURN
+
+	// The caller returns what a STATICCALL to the callee returns, or fails
+	// with INVALID if the callee has no code
+	calleeAddress := common.HexToAddress(callee.Address)
+	caller := []byte{0x73}
+	caller = append(caller, calleeAddress[:]...)
+	caller = append(caller, 0x3b, 0x60, 0x1a, 0x57, 0xfe, 0x5b) // EXTCODESIZE, PUSH1 26, JUMPI, INVALID, JUMPDEST
+	caller = append(caller, 0x60, 0x20, 0x5f, 0x5f, 0x5f, 0x73) // PUSH1 32, PUSH0, PUSH0, PUSH0, PUSH20
+	caller = append(caller, calleeAddress[:]...)
+	caller = append(caller, 0x5a, 0xfa, 0x50, 0x60, 0x20, 0x5f, 0xf3) // GAS, STATICCALL, POP, PUSH1 32, PUSH0, RETURN
+	contract := deployRuntime(t, caller)
+
+	request := httptest.NewRequest(http.MethodPost, "/contracts/"+contract.ID+"/execute", strings.NewReader(`{"functionSignature":"answer"}`))
+	response := httptest.NewRecorder()
+	routes(chain).ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", response.Code, response.Body)
+	}
+	var result struct {
+		Result string `json:"result"`
+	}
+	if err := json.Unmarshal(response.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Result != "42" {
+		t.Errorf("result %q, want 42", result.Result)
+	}
+}
+
+// TestExecuteRejectsStateChanges checks that an unsigned call may only change
+// state when it is simulated, and that a simulated call leaves it unchanged.
+func TestExecuteRejectsStateChanges(t *testing.T) {
+	chain := newTestChain(t)
+	contract := deployRuntime(t, []byte{0x60, 0x01, 0x5f, 0x55, 0x00}) // PUSH1 1, PUSH0, SSTORE, STOP
+	ExecutionEnvironments[contract.ID].ABI = []byte(`[{"type":"function","name":"set","stateMutability":"nonpayable","inputs":[],"outputs":[]}]`)
+
+	tests := []struct {
+		body string
+		code int
+	}{
+		{`{"functionSignature":"set","from":"0x00000000000000000000000000000000000000aa"}`, http.StatusBadRequest},
+		{`{"functionSignature":"set","from":"0x00000000000000000000000000000000000000aa","simulate":true}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		request := httptest.NewRequest(http.MethodPost, "/contracts/"+contract.ID+"/execute", strings.NewReader(tt.body))
+		response := httptest.NewRecorder()
+		routes(chain).ServeHTTP(response, request)
+		if response.Code != tt.code {
+			t.Errorf("%s: status %d, want %d: %s", tt.body, response.Code, tt.code, response.Body)
+		}
+	}
+
+	if value := chain.State()[common.HexToAddress(contract.Address)].GetState(common.Hash{}); value != (common.Hash{}) {
+		t.Errorf("slot 0 is %x, want it unchanged", value)
+	}
+}
+
+// TestMineInBackground checks that /mine responds before the block is mined,
+// and that the block is then added.
+func TestMineInBackground(t *testing.T) {
+	chain := newTestChain(t)
+	length := len(chain.Chain())
+
+	response := httptest.NewRecorder()
+	routes(chain).ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/mine", nil))
+	if response.Code != http.StatusAccepted {
+		t.Fatalf("status %d: %s", response.Code, response.Body)
+	}
+
+	// Wait for the mining to finish
+	mining.Lock()
+	mining.Unlock()
+	if got := len(chain.Chain()); got != length+1 {
+		t.Errorf("chain has %d blocks, want %d", got, length+1)
+	}
+}
+
+// TestReadAccountWhileMining polls an account while blocks that change it are
+// mined through /mine, for the race detector to check that the handlers only
+// read the state mining leaves.
+func TestReadAccountWhileMining(t *testing.T) {
+	chain := newTestChain(t)
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	handler := routes(chain)
+
+	done := make(chan struct{})
+	polled := make(chan struct{})
+	go func() {
+		defer close(polled)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			response := httptest.NewRecorder()
+			handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/accounts/"+sender.Hex(), nil))
+			if response.Code != http.StatusOK {
+				t.Errorf("status %d: %s", response.Code, response.Body)
+				return
+			}
+		}
+	}()
+
+	const blocks = 5
+	for i := 0; i < blocks; i++ {
+		tx := &blockchain.Transaction{Nonce: uint64(i), Recipient: sender.Hex(), Value: new(big.Int)}
+		if err := blockchain.SignTransaction(tx, key); err != nil {
+			t.Fatal(err)
+		}
+		if err := chain.AddTransaction(tx); err != nil {
+			t.Fatalf("transaction rejected: %v", err)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/mine", nil))
+		if response.Code != http.StatusAccepted {
+			t.Fatalf("status %d: %s", response.Code, response.Body)
+		}
+		mining.Lock()
+		mining.Unlock()
+	}
+	close(done)
+	<-polled
+
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/accounts/"+sender.Hex(), nil))
+	var account struct {
+		Nonce uint64 `json:"nonce"`
+	}
+	if err := json.Unmarshal(response.Body.Bytes(), &account); err != nil {
+		t.Fatal(err)
+	}
+	if account.Nonce != blocks {
+		t.Errorf("nonce %d, want %d", account.Nonce, blocks)
+	}
+}
+
+// TestValidateRequiresAdminToken checks that the chain can only be audited
+// with the admin token, and not at all without one.
+func TestValidateRequiresAdminToken(t *testing.T) {
+	chain := newTestChain(t)
+	defer func(token string) { AdminToken = token }(AdminToken)
+
+	tests := []struct {
+		adminToken    string
+		method        string
+		authorization string
+		code          int
+	}{
+		{"", http.MethodPost, "", http.StatusForbidden},
+		{"", http.MethodPost, "Bearer ", http.StatusForbidden},
+		{"secret", http.MethodPost, "", http.StatusUnauthorized},
+		{"secret", http.MethodPost, "Bearer wrong", http.StatusUnauthorized},
+		{"secret", http.MethodPost, "secret", http.StatusUnauthorized},
+		{"secret", http.MethodGet, "Bearer secret", http.StatusMethodNotAllowed},
+		{"secret", http.MethodPost, "Bearer secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		AdminToken = tt.adminToken
+		request := httptest.NewRequest(tt.method, "/admin/validate", nil)
+		if tt.authorization != "" {
+			request.Header.Set("Authorization", tt.authorization)
+		}
+		response := httptest.NewRecorder()
+		routes(chain).ServeHTTP(response, request)
+		if response.Code != tt.code {
+			t.Errorf("token %q, %s with %q: status %d, want %d", tt.adminToken, tt.method, tt.authorization, response.Code, tt.code)
+		}
+	}
+}
@@ -12,8 +12,13 @@ import (
 
 var bc *blockchain.Blockchain
 
-func Start() {
-	bc = blockchain.NewBlockchain()
+// AdminToken is the bearer token the /admin endpoints require. They are
+// disabled while it is empty.
+var AdminToken string
+
+// Start creates a chain with the given parameters and serves the API for it.
+func Start(config *blockchain.Config) {
+	bc = blockchain.NewBlockchainWithConfig(config)
 	blockchain.BlockchainInstance = &blockchain.BlockchainWrapper{Blockchain: bc}
 
 	PORT := "8080"
@@ -1,20 +1,36 @@
 package blockchain
 
 import (
-	"crypto/sha256"
+	"bytes"
 	"encoding/hex"
 	"fmt"
 	"log"
+	"math/big"
 	"smartley-contracts/contracts"
 	"smartley-contracts/types"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 )
 
 type Transaction struct {
-	Sender            string        `json:"sender"`
-	Recipient         string        `json:"recipient"`
+	Type              TxType        `json:"type,omitempty"` // Format of the transaction, NativeTxType if empty
+	Sender            string        `json:"sender"`         // Set from the signature of signed transactions
+	Recipient         string        `json:"recipient"`      // Empty for Ethereum transactions that deploy a contract
 	Payload           string        `json:"payload"`
+	Nonce             uint64        `json:"nonce"`                              // Number of transactions the sender sent before this one
+	Value             *big.Int      `json:"value,omitempty"`                    // Wei sent with the transaction
+	GasPrice          *big.Int      `json:"gas_price,omitempty"`                // Wei paid per unit of gas
+	GasTipCap         *big.Int      `json:"max_priority_fee_per_gas,omitempty"` // EIP-1559 transactions only, in place of GasPrice
+	GasFeeCap         *big.Int      `json:"max_fee_per_gas,omitempty"`          // EIP-1559 transactions only, in place of GasPrice
+	GasLimit          uint64        `json:"gas_limit,omitempty"`                // Gas available to the transaction, contracts.DefaultGasLimit if 0
+	Data              hexutil.Bytes `json:"data,omitempty"`                     // Input of an Ethereum transaction calling a contract
+	Signature         hexutil.Bytes `json:"signature,omitempty"`                // Sender's secp256k1 signature of SigningHash, as [R || S || V]
 	Contract          []byte        // Existing field
 	FunctionSignature string        // Existing field
 	ABI               []byte        // New field: ABI data
@@ -22,34 +38,63 @@ type Transaction struct {
 }
 
 type Block struct {
-	Index        int            `json:"index"`
-	Timestamp    string         `json:"timestamp"`
-	Transactions []*Transaction `json:"transactions"`
-	Proof        int            `json:"proof"`
-	PreviousHash string         `json:"previous_hash"`
+	Header
+	Transactions    []*Transaction `json:"transactions"`
+	Receipts        []*Receipt     `json:"receipts"`         // One per transaction, in the same order
+	TotalDifficulty *big.Int       `json:"total_difficulty"` // Sum of the difficulties of the chain up to this block
 }
 
 type Blockchain struct {
 	chain               []*Block
 	currentTransactions []*Transaction
-	State               map[string]types.Storage // Maps contract addresses to their storage states
+	state               map[common.Address]*types.Storage // Accounts as the last block left them
+	config              *Config
+	systemNonce         uint64 // Nonce of the next system transaction
+
+	mu     sync.RWMutex // Guards chain, currentTransactions, state and systemNonce
+	mining sync.Mutex   // Held by AddBlock, so that blocks are mined one at a time
 }
 
+// GetCurrentTransactions returns the transactions waiting to be mined.
 func (b *Blockchain) GetCurrentTransactions() []*Transaction {
-	return b.currentTransactions
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return append([]*Transaction(nil), b.currentTransactions...)
 }
 
+// Chain returns the blocks of the chain, from the genesis block. Blocks are
+// only ever appended, so the slice stays valid as the chain grows.
 func (b *Blockchain) Chain() []*Block {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
 	return b.chain
 }
 
+// State returns the accounts as the last block left them. Each block is
+// executed against a copy of its parent's accounts, which it replaces once the
+// block is mined, so the map returned is never modified and stays valid while
+// blocks are mined; callers must not modify it either.
+func (b *Blockchain) State() map[common.Address]*types.Storage {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.state
+}
+
+// NewBlockchain creates a chain with the default configuration.
 func NewBlockchain() *Blockchain {
+	return NewBlockchainWithConfig(DefaultConfig())
+}
+
+// NewBlockchainWithConfig creates a chain with the given parameters and mines
+// its genesis block.
+func NewBlockchainWithConfig(config *Config) *Blockchain {
 	log.Println("Creating new Blockchain instance")
 	b := &Blockchain{
 		chain:               make([]*Block, 0),
 		currentTransactions: make([]*Transaction, 0),
-		State:               make(map[string]types.Storage),
+		config:              config,
 	}
+	b.state = b.genesisState()
 
 	log.Println("Adding genesis block")
 	b.AddBlock()
@@ -58,73 +103,145 @@ func NewBlockchain() *Blockchain {
 	return b
 }
 
-func (b *Blockchain) AddTransaction(transaction *Transaction) {
+// AddTransaction adds a signed transaction to the pool of transactions for the
+// next block, setting its sender to the account that signed it. Transactions
+// with an invalid signature, or a nonce the sender has already used, are
+// rejected.
+func (b *Blockchain) AddTransaction(transaction *Transaction) error {
+	if err := transaction.verifySender(); err != nil {
+		return err
+	}
+	if nonce := accountNonce(b.State(), AddressFromString(transaction.Sender)); transaction.Nonce < nonce {
+		return fmt.Errorf("%w: address %s, tx %d, state %d", ErrNonceTooLow, transaction.Sender, transaction.Nonce, nonce)
+	}
+	b.mu.Lock()
+	b.currentTransactions = append(b.currentTransactions, transaction)
+	b.mu.Unlock()
+	return nil
+}
+
+// addSystemTransaction adds a transaction the node sends on its own behalf,
+// from the unsigned "0" sender, to the pool. It sets the transaction's nonce
+// to the system account's next one, as the sender and nonce are what tell
+// otherwise identical transactions, and so their hashes, apart.
+func (b *Blockchain) addSystemTransaction(transaction *Transaction) {
+	b.mu.Lock()
+	transaction.Sender = "0"
+	transaction.Nonce = b.systemNonce
+	b.systemNonce++
 	b.currentTransactions = append(b.currentTransactions, transaction)
+	b.mu.Unlock()
 }
 
+// AddBlock mines the transactions in the pool into a new block and appends it
+// to the chain. It returns once the proof of work is found, about one block
+// interval later; transactions added meanwhile wait for the next block.
 func (b *Blockchain) AddBlock() {
+	b.mining.Lock()
+	defer b.mining.Unlock()
+	b.mineBlock()
+}
+
+// mineSystemTransaction adds a system transaction to the pool and mines it
+// into a new block, returning the block and the transaction's index in it.
+// Holding the mining lock throughout keeps any other block from taking the
+// transaction first.
+func (b *Blockchain) mineSystemTransaction(tx *Transaction) (*Block, int) {
+	b.mining.Lock()
+	defer b.mining.Unlock()
+	b.addSystemTransaction(tx)
+	block := b.mineBlock()
+	for i, mined := range block.Transactions {
+		if mined == tx {
+			return block, i
+		}
+	}
+	return block, -1
+}
+
+// mineBlock mines the transactions in the pool into a new block, appends it
+// to the chain and returns it. The caller holds the mining lock.
+func (b *Blockchain) mineBlock() *Block {
 	log.Println("Adding block to the chain")
 
+	// Only mineBlock changes the chain and its state, so they stay as read
+	// here until the block is appended
+	chain := b.Chain()
+	state := make(map[common.Address]*types.Storage)
+	for address, account := range b.State() {
+		state[address] = account
+	}
 	var previousHash string
 
-	if len(b.chain) == 0 {
+	if len(chain) == 0 {
 		previousHash = "1"
 	} else {
-		lastBlock := b.chain[len(b.chain)-1]
+		lastBlock := chain[len(chain)-1]
 		previousHash = b.Hash(lastBlock)
 	}
 
 	block := &Block{
-		Index:        len(b.chain) + 1,
-		Timestamp:    strconv.FormatInt(time.Now().Unix(), 10),
-		Transactions: b.currentTransactions,
-		Proof:        0,
-		PreviousHash: previousHash,
+		Header: Header{
+			Index:        len(chain) + 1,
+			Timestamp:    strconv.FormatInt(time.Now().Unix(), 10),
+			Proof:        0,
+			Difficulty:   CalcDifficulty(chain, b.config.BlockInterval),
+			PreviousHash: previousHash,
+			Coinbase:     b.config.Coinbase,
+			BaseFee:      new(big.Int),
+		},
+		Transactions: b.GetCurrentTransactions(),
+	}
+	block.TotalDifficulty = new(big.Int).Add(b.TotalDifficulty(), block.Difficulty)
+
+	// Execute transactions against the copy of the state and record their
+	// receipts with the block. Transactions replace the accounts they change
+	// with new ones, so the accounts shared with the parent's state are left
+	// as they were.
+	block.Receipts = make([]*Receipt, 0, len(block.Transactions))
+	for i, tx := range block.Transactions {
+		receipt := b.applyTransaction(state, tx, block, nil)
+		receipt.TransactionHash, _ = tx.Hash() // Pooled transactions are known to encode
+		receipt.TransactionIndex = i
+		block.Receipts = append(block.Receipts, receipt)
 	}
 
+	// Commit the header to the transactions and their outcome
+	block.TransactionsRoot, _ = TransactionsRoot(block.Transactions)
+	block.ReceiptsRoot = ReceiptsRoot(block.Receipts)
+	block.StateRoot = StateRoot(state)
+
 	log.Println("Calculating proof of work")
-	proof := b.ProofOfWork()
+	proof := ProofOfWork(&block.Header)
 	block.Proof = proof
 	log.Println("Proof of work calculated:", proof)
 
+	// Append the block, swap in the state it left and remove its
+	// transactions from the pool, which only grows while the block is mined
 	log.Println("Appending block to the chain")
+	b.mu.Lock()
 	b.chain = append(b.chain, block)
+	b.state = state
+	b.currentTransactions = b.currentTransactions[len(block.Transactions):]
+	b.mu.Unlock()
 	log.Println("Block added to the chain")
-
-	// Execute transactions
-	for _, tx := range b.currentTransactions {
-		b.HandleTransaction(tx)
-	}
-
-	// Clear the current transaction pool
-	b.currentTransactions = []*Transaction{}
+	return block
 }
 
+// Hash returns the hash of block's header as a hex string, as blocks refer to
+// their parent by.
 func (b *Blockchain) Hash(block *Block) string {
-	hash := sha256.New()
-
-	hash.Write([]byte(block.PreviousHash +
-		strconv.Itoa(block.Proof) +
-		block.Timestamp,
-	))
-
-	return hex.EncodeToString(hash.Sum(nil))
-}
-
-func GenerateContractAddress(sender string, numContracts int) string {
-	h := sha256.New()
-	h.Write([]byte(sender + strconv.Itoa(numContracts)))
-	hashed := h.Sum(nil)
-	return hex.EncodeToString(hashed)[:20] // Truncate the address for simplicity
+	hash := block.Header.Hash()
+	return hex.EncodeToString(hash[:])
 }
 
 type BlockchainWrapper struct {
 	*Blockchain
-	State map[string]types.Storage
+	State map[common.Address]*types.Storage
 }
 
 func (bw *BlockchainWrapper) ExecuteFunction(contractAddress, functionSignature string, args []interface{}) error {
-	storage, ok := bw.State[contractAddress]
+	storage, ok := bw.State[AddressFromString(contractAddress)]
 	if !ok {
 		return fmt.Errorf("contract not found at address: %s", contractAddress)
 	}
@@ -132,15 +249,17 @@ func (bw *BlockchainWrapper) ExecuteFunction(contractAddress, functionSignature
 	env := &contracts.VMExecutionEnvironment{
 		Stack:          make(types.Stack, 0),
 		Memory:         make(types.Memory, 0),
-		Storage:        storage,
 		ProgramCounter: 0,
 		Bytecode:       storage.GetBytecode(),
 		ABI:            storage.GetABI(),
+		GasLimit:       contracts.DefaultGasLimit,
+		Context: bw.ExecutionContext(&Transaction{
+			Sender:    "0",
+			Recipient: contractAddress,
+		}, bw.LastBlock()),
+		State: contracts.NewStateDB(bw.State),
 	}
 	_, err := env.ExecuteWithArgs(functionSignature, args)
-	if err == nil {
-		bw.State[contractAddress] = storage
-	}
 	return err
 }
 
@@ -148,71 +267,121 @@ var BlockchainInstance *BlockchainWrapper
 
 func (bw *BlockchainWrapper) Init() {
 	BlockchainInstance = bw
-	BlockchainInstance.State = make(map[string]types.Storage)
+	BlockchainInstance.State = make(map[common.Address]*types.Storage)
 }
 
 var _ contracts.ContractHandler = (*BlockchainWrapper)(nil)
 
+// DeployContract deploys the contract's creation bytecode with its constructor
+// arguments through a transaction mined into a new block, and sets
+// contract.Address to the address the chain deployed it at. It mines the block
+// itself, so that the address is known when it returns, and so blocks for as
+// long as the proof of work takes, about one block interval.
 func (bw *BlockchainWrapper) DeployContract(contract *contracts.Contract) error {
-	// Compile the Solidity contract code into bytecode
-	compiledContract, err := contracts.CompileSolidityString(contract.SoliditySource)
+	initCode, err := hex.DecodeString(strings.TrimPrefix(contract.Bytecode, "0x"))
 	if err != nil {
-		return err
+		return fmt.Errorf("invalid contract bytecode: %v", err)
+	}
+	parsedABI, err := abi.JSON(bytes.NewReader(contract.ABI))
+	if err != nil {
+		return fmt.Errorf("failed to parse ABI: %v", err)
+	}
+	args, err := contracts.ParseArgs(parsedABI.Constructor.Inputs, contract.ConstructorArgs)
+	if err != nil {
+		return fmt.Errorf("invalid constructor arguments: %v", err)
 	}
 
-	// Generate a contract address
-	contractAddress := contracts.GenerateContractAddress()
-
-	// Create a transaction with the contract bytecode as the payload and add it to the current transaction pool
+	// Create a transaction with the creation bytecode and add it to the current transaction pool
 	txn := &Transaction{
-		Sender:    "0",
-		Recipient: contractAddress,
-		Payload:   compiledContract,
+		Contract:  initCode,
+		ABI:       contract.ABI,
+		Arguments: args,
 	}
-	bw.AddTransaction(txn)
-
-	// Update the contract object with the contract address
-	contract.Address = contractAddress
+	block, index := bw.mineSystemTransaction(txn)
+	if index < 0 {
+		return fmt.Errorf("contract deployment was not mined in block %d", block.Index)
+	}
+	receipt := block.Receipts[index]
+	if receipt.Status != ReceiptStatusSuccessful {
+		return fmt.Errorf("contract deployment failed: %s", receipt.Error)
+	}
+	contract.Address = receipt.ContractAddress
 
 	return nil
 }
 
-func (bw *Blockchain) HandleTransaction(tx *Transaction) {
-	if len(tx.Contract) > 0 {
-		// Deploy a new smart contract
-		contractAddress := GenerateContractAddress(tx.Sender, len(bw.State))
-		storage := make(types.Storage)
+// applyTransaction executes tx as part of block against the accounts in state,
+// reporting the execution to tracer if it is not nil, and returns its receipt.
+func (bw *Blockchain) applyTransaction(state map[common.Address]*types.Storage, tx *Transaction, block *Block, tracer contracts.Tracer) *Receipt {
+	// A signed transaction runs only with the sender's next nonce, so that it
+	// cannot be replayed
+	if len(tx.Signature) > 0 {
+		if err := checkNonce(state, tx); err != nil {
+			return newReceipt(nil, err)
+		}
+	}
+
+	if tx.isDeployment() {
+		// Deploy a new smart contract: run its init code with the constructor
+		// arguments and keep the runtime code it returns
 		env := &contracts.VMExecutionEnvironment{
 			Stack:          make(types.Stack, 0),
 			Memory:         make(types.Memory, 0),
-			Storage:        storage,
 			ProgramCounter: 0,
-			Bytecode:       tx.Contract,
 			ABI:            tx.ABI, // Include the ABI from the transaction
+			GasLimit:       tx.gasLimit(),
+			Context:        bw.ExecutionContext(tx, block),
+			State:          contracts.NewStateDB(state),
+			Tracer:         tracer,
 		}
-		_, err := env.ExecuteWithArgs("", nil) // Use ExecuteWithArgs with empty function signature and no arguments
-		if err == nil {
-			bw.State[contractAddress] = storage
-		}
-	} else if len(tx.FunctionSignature) > 0 {
+		result, err := env.Deploy(tx.Contract, tx.Arguments)
+		receipt := newReceipt(result, err)
+		receipt.ContractAddress = env.Context.Address.Hex()
+		return receipt
+	}
+
+	// Deployments use the nonce up in deriving the new contract's address;
+	// every other transaction uses it up whether or not it succeeds
+	nonceState := contracts.NewStateDB(state)
+	sender := AddressFromString(tx.Sender)
+	nonceState.SetNonce(sender, nonceState.GetNonce(sender)+1)
+	nonceState.Commit()
+
+	if tx.Type == NativeTxType && len(tx.FunctionSignature) > 0 {
 		// Execute a smart contract function
-		storage, ok := bw.State[tx.Recipient]
+		storage, ok := state[AddressFromString(tx.Recipient)]
 		if !ok {
 			log.Printf("Contract not found at address: %s\n", tx.Recipient)
-			return
+			return newReceipt(nil, fmt.Errorf("contract not found at address: %s", tx.Recipient))
 		}
 
 		env := &contracts.VMExecutionEnvironment{
 			Stack:          make(types.Stack, 0),
 			Memory:         make(types.Memory, 0),
-			Storage:        storage,
 			ProgramCounter: 0,
 			Bytecode:       storage.GetBytecode(),
 			ABI:            storage.GetABI(), // Use the GetABI method
+			GasLimit:       tx.gasLimit(),
+			Context:        bw.ExecutionContext(tx, block),
+			State:          contracts.NewStateDB(state), // Other contracts are reachable through CALL
+			Tracer:         tracer,
 		}
-		_, err := env.ExecuteWithArgs(tx.FunctionSignature, tx.Arguments) // Use ExecuteWithArgs with function signature and arguments from the transaction
-		if err == nil {
-			bw.State[tx.Recipient] = storage
-		}
+		result, err := env.ExecuteWithArgs(tx.FunctionSignature, tx.Arguments) // Use ExecuteWithArgs with function signature and arguments from the transaction
+		return newReceipt(result, err)
+	}
+
+	// Plain transactions transfer value, running the recipient's code if it has
+	// any with the input of Ethereum transactions
+	env := &contracts.VMExecutionEnvironment{
+		Stack:          make(types.Stack, 0),
+		Memory:         make(types.Memory, 0),
+		ProgramCounter: 0,
+		GasLimit:       tx.gasLimit(),
+		Context:        bw.ExecutionContext(tx, block),
+		State:          contracts.NewStateDB(state),
+		Tracer:         tracer,
 	}
+	env.Bytecode = env.State.GetCode(env.Context.Address)
+	_, err := env.ExecuteInput(env.Bytecode, tx.Data)
+	return newReceipt(&contracts.ExecutionResult{GasUsed: env.GasUsed, Logs: env.Logs()}, err)
 }
@@ -0,0 +1,149 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"smartley-contracts/contracts"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// testKey signs the transactions of the tests. Its account is funded by
+// newTestChain.
+var testKey, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+
+// newTestChain creates a chain on which the account of testKey holds balance wei.
+func newTestChain(t *testing.T, balance int64) *Blockchain {
+	t.Helper()
+	config := DefaultConfig()
+	config.GenesisAlloc[crypto.PubkeyToAddress(testKey.PublicKey)] = big.NewInt(balance)
+	return NewBlockchainWithConfig(config)
+}
+
+// sendSigned signs tx with testKey, adds it to the pool and mines it, and
+// returns its receipt.
+func sendSigned(t *testing.T, b *Blockchain, tx *Transaction) *Receipt {
+	t.Helper()
+	if err := SignTransaction(tx, testKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.AddTransaction(tx); err != nil {
+		t.Fatalf("transaction rejected: %v", err)
+	}
+	b.AddBlock()
+	receipts := b.LastBlock().Receipts
+	return receipts[len(receipts)-1]
+}
+
+// TestValueTransfer sends value from an account funded at genesis, and more
+// value than it has left.
+func TestValueTransfer(t *testing.T) {
+	b := newTestChain(t, 1000)
+	sender := crypto.PubkeyToAddress(testKey.PublicKey)
+	recipient := common.HexToAddress("0x000000000000000000000000000000000000b0b0")
+
+	receipt := sendSigned(t, b, &Transaction{Nonce: 0, Recipient: recipient.Hex(), Value: big.NewInt(400)})
+	if receipt.Status != ReceiptStatusSuccessful {
+		t.Fatalf("transfer failed: %s", receipt.Error)
+	}
+	receipt = sendSigned(t, b, &Transaction{Nonce: 1, Recipient: recipient.Hex(), Value: big.NewInt(700)})
+	if receipt.Status != ReceiptStatusFailed {
+		t.Fatal("transfer of more than the balance succeeded")
+	}
+
+	if balance := b.State()[sender].GetBalance().Uint64(); balance != 600 {
+		t.Errorf("sender balance %d, want 600", balance)
+	}
+	if balance := b.State()[recipient].GetBalance().Uint64(); balance != 400 {
+		t.Errorf("recipient balance %d, want 400", balance)
+	}
+}
+
+// TestBlockContext runs code that stores what each block context opcode
+// returns, and checks it against the header of the block it was mined in.
+func TestBlockContext(t *testing.T) {
+	config := DefaultConfig()
+	config.GenesisAlloc[crypto.PubkeyToAddress(testKey.PublicKey)] = big.NewInt(1000)
+	config.Coinbase = common.HexToAddress("0x000000000000000000000000000000000000c0c0")
+	b := NewBlockchainWithConfig(config)
+
+	// Each opcode's result is stored in its own slot, the previous block's
+	// hash in the last
+	runtime := []byte{
+		0x41, 0x60, 0x00, 0x55, // COINBASE, PUSH1 0, SSTORE
+		0x42, 0x60, 0x01, 0x55, // TIMESTAMP
+		0x43, 0x60, 0x02, 0x55, // NUMBER
+		0x44, 0x60, 0x03, 0x55, // DIFFICULTY
+		0x45, 0x60, 0x04, 0x55, // GASLIMIT
+		0x46, 0x60, 0x05, 0x55, // CHAINID
+		0x48, 0x60, 0x06, 0x55, // BASEFEE
+		0x60, 0x01, 0x43, 0x03, 0x40, 0x60, 0x07, 0x55, // PUSH1 1, NUMBER, SUB, BLOCKHASH
+	}
+	// Copy the runtime code to memory and return it
+	initCode := append([]byte{0x60, byte(len(runtime)), 0x80, 0x60, 0x09, 0x5f, 0x39, 0x5f, 0xf3}, runtime...)
+	receipt := sendSigned(t, b, &Transaction{Nonce: 0, Contract: initCode})
+	if receipt.Status != ReceiptStatusSuccessful {
+		t.Fatalf("deployment failed: %s", receipt.Error)
+	}
+	address := common.HexToAddress(receipt.ContractAddress)
+	if receipt = sendSigned(t, b, &Transaction{Nonce: 1, Recipient: address.Hex()}); receipt.Status != ReceiptStatusSuccessful {
+		t.Fatalf("call failed: %s", receipt.Error)
+	}
+
+	chain := b.Chain()
+	block, parent := chain[len(chain)-1], chain[len(chain)-2]
+	parentHash, _ := hex.DecodeString(b.Hash(parent))
+	tests := []struct {
+		name string
+		want common.Hash
+	}{
+		{"COINBASE", common.BytesToHash(config.Coinbase.Bytes())},
+		{"TIMESTAMP", common.BigToHash(big.NewInt(timestamp(block)))},
+		{"NUMBER", common.BigToHash(big.NewInt(int64(block.Index)))},
+		{"DIFFICULTY", common.BigToHash(block.Difficulty)},
+		{"GASLIMIT", common.BigToHash(new(big.Int).SetUint64(contracts.DefaultGasLimit))},
+		{"CHAINID", common.BigToHash(ChainID)},
+		{"BASEFEE", common.BigToHash(block.BaseFee)},
+		{"BLOCKHASH", common.BytesToHash(parentHash)},
+	}
+	for i, tt := range tests {
+		if got := b.State()[address].GetState(common.BigToHash(big.NewInt(int64(i)))); got != tt.want {
+			t.Errorf("%s returned %s, want %s", tt.name, got.Hex(), tt.want.Hex())
+		}
+	}
+	if block.Coinbase != config.Coinbase {
+		t.Errorf("block coinbase %s, want %s", block.Coinbase.Hex(), config.Coinbase.Hex())
+	}
+}
+
+// TestSystemTransactionNonces checks that identical transactions the node
+// sends itself get their own nonces, and so their own hashes and receipts.
+func TestSystemTransactionNonces(t *testing.T) {
+	b := newTestChain(t, 0)
+	initCode := []byte{0x60, 0x01, 0x60, 0x1f, 0xf3} // PUSH1 1, PUSH1 31, RETURN
+	first := &Transaction{Contract: initCode}
+	second := &Transaction{Contract: initCode}
+	b.addSystemTransaction(first)
+	b.addSystemTransaction(second)
+	if first.Nonce == second.Nonce {
+		t.Errorf("both transactions have nonce %d", first.Nonce)
+	}
+
+	firstHash, _ := first.Hash()
+	secondHash, _ := second.Hash()
+	if firstHash == secondHash {
+		t.Fatalf("both transactions hash to %s", firstHash.Hex())
+	}
+	b.AddBlock()
+	_, firstReceipt, _ := b.GetTransaction(firstHash)
+	_, secondReceipt, _ := b.GetTransaction(secondHash)
+	if firstReceipt == nil || secondReceipt == nil {
+		t.Fatal("deployments not mined")
+	}
+	if firstReceipt.ContractAddress == secondReceipt.ContractAddress {
+		t.Errorf("both deployments at %s", firstReceipt.ContractAddress)
+	}
+}
@@ -0,0 +1,53 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Config holds the parameters a chain is created with.
+type Config struct {
+	GenesisAlloc  GenesisAlloc   // Balances accounts start with
+	BlockInterval time.Duration  // Time between blocks that the difficulty adjusts towards
+	Coinbase      common.Address // Account named as the miner of new blocks
+}
+
+// GenesisAlloc maps accounts to the balances, in wei, they start with on a
+// new chain.
+type GenesisAlloc map[common.Address]*big.Int
+
+// DefaultConfig returns the parameters NewBlockchain creates a chain with. The
+// zero address, which sends the transactions the node creates on its own
+// behalf, holds the initial supply.
+func DefaultConfig() *Config {
+	return &Config{
+		GenesisAlloc: GenesisAlloc{
+			{}: new(big.Int).Exp(big.NewInt(10), big.NewInt(27), nil), // 1e9 ether
+		},
+		BlockInterval: 10 * time.Second,
+	}
+}
+
+// LoadGenesisAlloc reads a genesis allocation from a JSON file mapping hex
+// addresses to balances in wei, such as {"0x71c7...76f": 1000000000000000000}.
+func LoadGenesisAlloc(path string) (GenesisAlloc, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var alloc GenesisAlloc
+	if err := json.Unmarshal(data, &alloc); err != nil {
+		return nil, fmt.Errorf("invalid genesis allocation %s: %v", path, err)
+	}
+	for address, balance := range alloc {
+		if balance == nil || balance.Sign() < 0 || balance.BitLen() > 256 {
+			return nil, fmt.Errorf("invalid genesis allocation %s: balance of %s out of range", path, address.Hex())
+		}
+	}
+	return alloc, nil
+}
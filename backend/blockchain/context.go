@@ -0,0 +1,77 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"math/big"
+	"regexp"
+	"strconv"
+
+	"smartley-contracts/contracts"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/holiman/uint256"
+)
+
+var hexAddressPattern = regexp.MustCompile(`^(0x|0X)?[0-9a-fA-F]{0,40}$`)
+
+// ChainID identifies this chain to contract code through the CHAINID opcode.
+var ChainID = big.NewInt(1337)
+
+// AddressFromString converts a transaction party into a 20-byte account address.
+// Hex strings of up to 40 digits, such as contract addresses and the "0" system
+// sender, are used as they are. Any other name, such as the "Bob" used by the
+// sample transactions, maps to the last 20 bytes of its Keccak-256 hash so that
+// the same name always acts as the same account.
+func AddressFromString(s string) common.Address {
+	if hexAddressPattern.MatchString(s) {
+		return common.HexToAddress(s)
+	}
+	return common.BytesToAddress(crypto.Keccak256([]byte(s))[12:])
+}
+
+// ExecutionContext builds the context a transaction's contract code runs in when
+// it is executed as part of block.
+func (b *Blockchain) ExecutionContext(tx *Transaction, block *Block) contracts.ExecutionContext {
+	timestamp, _ := strconv.ParseUint(block.Timestamp, 10, 64)
+	sender := AddressFromString(tx.Sender)
+
+	return contracts.ExecutionContext{
+		Caller:        sender,
+		Origin:        sender,
+		Address:       AddressFromString(tx.Recipient),
+		Value:         bigToWord(tx.Value),
+		GasPrice:      bigToWord(tx.effectiveGasPrice()),
+		BlockNumber:   uint64(block.Index),
+		Timestamp:     timestamp,
+		ChainID:       bigToWord(ChainID),
+		Difficulty:    bigToWord(block.Difficulty),
+		Coinbase:      block.Coinbase,
+		BaseFee:       bigToWord(block.BaseFee),
+		BlockGasLimit: contracts.DefaultGasLimit,
+		GetHash:       b.getBlockHash,
+	}
+}
+
+// getBlockHash returns the hash of the block with the given index, or zero if
+// there is no such block.
+func (b *Blockchain) getBlockHash(number uint64) common.Hash {
+	chain := b.Chain()
+	if number == 0 || number > uint64(len(chain)) {
+		return common.Hash{}
+	}
+	hash, err := hex.DecodeString(b.Hash(chain[number-1]))
+	if err != nil {
+		return common.Hash{}
+	}
+	return common.BytesToHash(hash)
+}
+
+// bigToWord converts an optional big.Int amount into a VM word, treating nil as zero.
+func bigToWord(value *big.Int) *uint256.Int {
+	word := new(uint256.Int)
+	if value != nil {
+		word.SetFromBig(value)
+	}
+	return word
+}
@@ -0,0 +1,400 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// TxType identifies the format a transaction is encoded and signed in.
+type TxType string
+
+const (
+	// NativeTxType is this chain's own format, which names the contract
+	// function to call rather than carrying ABI-encoded call data.
+	NativeTxType TxType = ""
+
+	// LegacyTxType is an Ethereum transaction from before EIP-2718, with the
+	// replay protection of EIP-155.
+	LegacyTxType TxType = "legacy"
+
+	// DynamicFeeTxType is an Ethereum EIP-1559 transaction.
+	DynamicFeeTxType TxType = "dynamic_fee"
+)
+
+// EIP-2718 envelope types. Native transactions use the highest type the EIP
+// allows, which Ethereum leaves unused.
+const (
+	dynamicFeeTxEnvelope = 0x02
+	nativeTxEnvelope     = 0x7f
+)
+
+var (
+	// ErrUnsupportedTxType is returned when decoding a transaction of a type
+	// this chain does not run, such as an EIP-2930 or blob transaction.
+	ErrUnsupportedTxType = errors.New("transaction type not supported")
+
+	// ErrInvalidChainID is returned for an Ethereum transaction signed for
+	// another chain.
+	ErrInvalidChainID = errors.New("invalid chain id")
+
+	// ErrUnprotectedTx is returned for a legacy transaction signed without
+	// EIP-155 replay protection, which would be valid on every chain.
+	ErrUnprotectedTx = errors.New("only replay-protected (EIP-155) transactions allowed")
+
+	// ErrAccessListNotSupported is returned for an EIP-1559 transaction with a
+	// non-empty access list.
+	ErrAccessListNotSupported = errors.New("access lists are not supported")
+
+	// ErrNativeFields is returned for an Ethereum transaction that sets fields
+	// its encoding does not cover, such as a function signature, so that they
+	// would be neither signed nor hashed.
+	ErrNativeFields = errors.New("native transaction fields set on an Ethereum transaction")
+)
+
+// legacyTx is the RLP layout of a signed legacy transaction.
+type legacyTx struct {
+	Nonce    uint64
+	GasPrice *big.Int
+	Gas      uint64
+	To       *common.Address `rlp:"nil"`
+	Value    *big.Int
+	Data     []byte
+	V, R, S  *big.Int
+}
+
+// accessTuple is an entry of an EIP-2930 access list.
+type accessTuple struct {
+	Address     common.Address
+	StorageKeys []common.Hash
+}
+
+// dynamicFeeTx is the RLP layout of a signed EIP-1559 transaction, without
+// its envelope type.
+type dynamicFeeTx struct {
+	ChainID    *big.Int
+	Nonce      uint64
+	GasTipCap  *big.Int
+	GasFeeCap  *big.Int
+	Gas        uint64
+	To         *common.Address `rlp:"nil"`
+	Value      *big.Int
+	Data       []byte
+	AccessList []accessTuple
+	V, R, S    *big.Int
+}
+
+// nativeTx is the RLP layout of a native transaction, without its envelope
+// type. Unsigned transactions, which only the node itself sends, have an
+// empty signature.
+type nativeTx struct {
+	ChainID           *big.Int
+	Nonce             uint64
+	GasPrice          *big.Int
+	Gas               uint64
+	Recipient         string
+	Value             *big.Int
+	Payload           string
+	Contract          []byte
+	FunctionSignature string
+	ABI               []byte
+	Arguments         []byte // JSON, as the arguments are not typed until the call is made
+	Data              []byte
+	Signature         []byte
+}
+
+// MarshalBinary returns the canonical encoding of tx: the RLP list of a legacy
+// transaction, or for the other types the EIP-2718 envelope type followed by
+// the RLP list.
+func (tx *Transaction) MarshalBinary() ([]byte, error) {
+	switch tx.Type {
+	case NativeTxType:
+		arguments, err := json.Marshal(tx.Arguments)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode arguments: %v", err)
+		}
+		return envelope(nativeTxEnvelope, &nativeTx{
+			ChainID:           ChainID,
+			Nonce:             tx.Nonce,
+			GasPrice:          bigOrZero(tx.GasPrice),
+			Gas:               tx.GasLimit,
+			Recipient:         tx.Recipient,
+			Value:             bigOrZero(tx.Value),
+			Payload:           tx.Payload,
+			Contract:          tx.Contract,
+			FunctionSignature: tx.FunctionSignature,
+			ABI:               tx.ABI,
+			Arguments:         arguments,
+			Data:              tx.Data,
+			Signature:         tx.Signature,
+		})
+	case LegacyTxType:
+		v, r, s := tx.signatureValues()
+		if v.Sign() != 0 || r.Sign() != 0 || s.Sign() != 0 {
+			v.Add(v, new(big.Int).Add(big.NewInt(35), new(big.Int).Lsh(ChainID, 1)))
+		}
+		return rlp.EncodeToBytes(&legacyTx{
+			Nonce:    tx.Nonce,
+			GasPrice: bigOrZero(tx.GasPrice),
+			Gas:      tx.GasLimit,
+			To:       tx.to(),
+			Value:    bigOrZero(tx.Value),
+			Data:     tx.callData(),
+			V:        v,
+			R:        r,
+			S:        s,
+		})
+	case DynamicFeeTxType:
+		v, r, s := tx.signatureValues()
+		return envelope(dynamicFeeTxEnvelope, &dynamicFeeTx{
+			ChainID:    ChainID,
+			Nonce:      tx.Nonce,
+			GasTipCap:  bigOrZero(tx.GasTipCap),
+			GasFeeCap:  bigOrZero(tx.GasFeeCap),
+			Gas:        tx.GasLimit,
+			To:         tx.to(),
+			Value:      bigOrZero(tx.Value),
+			Data:       tx.callData(),
+			AccessList: []accessTuple{},
+			V:          v,
+			R:          r,
+			S:          s,
+		})
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnsupportedTxType, tx.Type)
+}
+
+// Hash returns the canonical hash of tx, the Keccak-256 hash of its encoding.
+// For Ethereum transactions it is the hash Ethereum tooling reports.
+func (tx *Transaction) Hash() (common.Hash, error) {
+	encoded, err := tx.MarshalBinary()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return crypto.Keccak256Hash(encoded), nil
+}
+
+// DecodeTransaction decodes a transaction from its canonical encoding, such
+// as a raw signed transaction produced by Ethereum tooling. The sender is not
+// set: AddTransaction recovers it from the signature.
+func DecodeTransaction(raw []byte) (*Transaction, error) {
+	if len(raw) == 0 {
+		return nil, errors.New("empty transaction")
+	}
+
+	// A legacy transaction is an RLP list, whose first byte is above any
+	// envelope type
+	if raw[0] > 0x7f {
+		var decoded legacyTx
+		if err := rlp.DecodeBytes(raw, &decoded); err != nil {
+			return nil, err
+		}
+		parity, err := legacyParity(decoded.V)
+		if err != nil {
+			return nil, err
+		}
+		tx := &Transaction{
+			Type:     LegacyTxType,
+			Nonce:    decoded.Nonce,
+			GasPrice: decoded.GasPrice,
+			GasLimit: decoded.Gas,
+			Value:    decoded.Value,
+		}
+		tx.setCallData(decoded.To, decoded.Data)
+		return tx, tx.setSignatureValues(parity, decoded.R, decoded.S)
+	}
+
+	switch raw[0] {
+	case dynamicFeeTxEnvelope:
+		var decoded dynamicFeeTx
+		if err := rlp.DecodeBytes(raw[1:], &decoded); err != nil {
+			return nil, err
+		}
+		if decoded.ChainID.Cmp(ChainID) != 0 {
+			return nil, fmt.Errorf("%w: have %s, want %s", ErrInvalidChainID, decoded.ChainID, ChainID)
+		}
+		if len(decoded.AccessList) > 0 {
+			return nil, ErrAccessListNotSupported
+		}
+		if !decoded.V.IsUint64() || decoded.V.Uint64() > 1 {
+			return nil, fmt.Errorf("%w: y parity %s", ErrInvalidSignature, decoded.V)
+		}
+		tx := &Transaction{
+			Type:      DynamicFeeTxType,
+			Nonce:     decoded.Nonce,
+			GasTipCap: decoded.GasTipCap,
+			GasFeeCap: decoded.GasFeeCap,
+			GasLimit:  decoded.Gas,
+			Value:     decoded.Value,
+		}
+		tx.setCallData(decoded.To, decoded.Data)
+		return tx, tx.setSignatureValues(byte(decoded.V.Uint64()), decoded.R, decoded.S)
+	case nativeTxEnvelope:
+		var decoded nativeTx
+		if err := rlp.DecodeBytes(raw[1:], &decoded); err != nil {
+			return nil, err
+		}
+		if decoded.ChainID.Cmp(ChainID) != 0 {
+			return nil, fmt.Errorf("%w: have %s, want %s", ErrInvalidChainID, decoded.ChainID, ChainID)
+		}
+		var arguments []interface{}
+		if err := json.Unmarshal(decoded.Arguments, &arguments); err != nil {
+			return nil, fmt.Errorf("failed to decode arguments: %v", err)
+		}
+		return &Transaction{
+			Nonce:             decoded.Nonce,
+			GasPrice:          decoded.GasPrice,
+			GasLimit:          decoded.Gas,
+			Recipient:         decoded.Recipient,
+			Value:             decoded.Value,
+			Payload:           decoded.Payload,
+			Contract:          decoded.Contract,
+			FunctionSignature: decoded.FunctionSignature,
+			ABI:               decoded.ABI,
+			Arguments:         arguments,
+			Data:              decoded.Data,
+			Signature:         decoded.Signature,
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: envelope type 0x%02x", ErrUnsupportedTxType, raw[0])
+}
+
+// ethereumSigningHash returns the hash the sender of an Ethereum transaction
+// signs, as defined by EIP-155 and EIP-1559. A transaction that sets fields
+// the hash does not cover has none, so it cannot be signed or verified.
+func (tx *Transaction) ethereumSigningHash() (common.Hash, error) {
+	if err := tx.checkEthereumFields(); err != nil {
+		return common.Hash{}, err
+	}
+	var encoded []byte
+	var err error
+	switch tx.Type {
+	case LegacyTxType:
+		encoded, err = rlp.EncodeToBytes([]interface{}{
+			tx.Nonce,
+			bigOrZero(tx.GasPrice),
+			tx.GasLimit,
+			tx.to(),
+			bigOrZero(tx.Value),
+			tx.callData(),
+			ChainID, uint(0), uint(0),
+		})
+	case DynamicFeeTxType:
+		encoded, err = envelope(dynamicFeeTxEnvelope, []interface{}{
+			ChainID,
+			tx.Nonce,
+			bigOrZero(tx.GasTipCap),
+			bigOrZero(tx.GasFeeCap),
+			tx.GasLimit,
+			tx.to(),
+			bigOrZero(tx.Value),
+			tx.callData(),
+			[]accessTuple{},
+		})
+	default:
+		err = fmt.Errorf("%w: %q", ErrUnsupportedTxType, tx.Type)
+	}
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return crypto.Keccak256Hash(encoded), nil
+}
+
+// checkEthereumFields checks that an Ethereum transaction only sets fields its
+// encoding covers: no native call fields, and no input to a deployment or
+// init code for a call, which callData leaves out.
+func (tx *Transaction) checkEthereumFields() error {
+	switch {
+	case tx.Payload != "", tx.FunctionSignature != "", len(tx.ABI) > 0, len(tx.Arguments) > 0:
+		return ErrNativeFields
+	case tx.Recipient == "" && len(tx.Data) > 0:
+		return fmt.Errorf("%w: data set on a deployment", ErrNativeFields)
+	case tx.Recipient != "" && len(tx.Contract) > 0:
+		return fmt.Errorf("%w: contract code set on a call", ErrNativeFields)
+	}
+	return nil
+}
+
+// envelope returns the EIP-2718 encoding of a typed transaction.
+func envelope(txType byte, payload interface{}) ([]byte, error) {
+	encoded, err := rlp.EncodeToBytes(payload)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{txType}, encoded...), nil
+}
+
+// to returns the address an Ethereum transaction is sent to, or nil for a deployment.
+func (tx *Transaction) to() *common.Address {
+	if tx.Recipient == "" {
+		return nil
+	}
+	address := AddressFromString(tx.Recipient)
+	return &address
+}
+
+// callData returns the data field of an Ethereum transaction: the init code of
+// a deployment, or the input of a call.
+func (tx *Transaction) callData() []byte {
+	if tx.Recipient == "" {
+		return tx.Contract
+	}
+	return tx.Data
+}
+
+// setCallData sets the recipient and data of a decoded Ethereum transaction.
+func (tx *Transaction) setCallData(to *common.Address, data []byte) {
+	if to == nil {
+		tx.Contract = data
+		return
+	}
+	tx.Recipient = to.Hex()
+	tx.Data = data
+}
+
+// signatureValues returns the signature of tx as the V, R and S values of an
+// Ethereum transaction, V being the y parity. They are all zero if tx is not signed.
+func (tx *Transaction) signatureValues() (v, r, s *big.Int) {
+	if len(tx.Signature) != crypto.SignatureLength {
+		return new(big.Int), new(big.Int), new(big.Int)
+	}
+	return new(big.Int).SetUint64(uint64(tx.Signature[64])),
+		new(big.Int).SetBytes(tx.Signature[:32]),
+		new(big.Int).SetBytes(tx.Signature[32:64])
+}
+
+// setSignatureValues sets the signature of tx from the y parity, R and S values
+// of an Ethereum transaction.
+func (tx *Transaction) setSignatureValues(parity byte, r, s *big.Int) error {
+	if r.BitLen() > 256 || s.BitLen() > 256 {
+		return ErrInvalidSignature
+	}
+	signature := make([]byte, crypto.SignatureLength)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:64])
+	signature[64] = parity
+	tx.Signature = signature
+	return nil
+}
+
+// legacyParity returns the y parity encoded in the V value of a legacy
+// transaction, which EIP-155 offsets by 35 plus twice the chain ID.
+func legacyParity(v *big.Int) (byte, error) {
+	if v.Cmp(big.NewInt(27)) == 0 || v.Cmp(big.NewInt(28)) == 0 {
+		return 0, ErrUnprotectedTx
+	}
+	offset := new(big.Int).Sub(v, big.NewInt(35))
+	if offset.Sign() < 0 {
+		return 0, fmt.Errorf("%w: v %s", ErrInvalidSignature, v)
+	}
+	chainID, parity := new(big.Int).QuoRem(offset, big.NewInt(2), new(big.Int))
+	if chainID.Cmp(ChainID) != 0 {
+		return 0, fmt.Errorf("%w: have %s, want %s", ErrInvalidChainID, chainID, ChainID)
+	}
+	return byte(parity.Uint64()), nil
+}
@@ -0,0 +1,179 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// TestEthereumTransactionVectors decodes, re-encodes and re-signs transactions
+// signed by go-ethereum with testKey for this chain's ID, and checks their
+// hashes against those go-ethereum reports.
+func TestEthereumTransactionVectors(t *testing.T) {
+	tests := []struct {
+		name        string
+		raw         string
+		hash        string
+		signingHash string
+		tx          *Transaction // The fields the transaction is signed with
+	}{
+		{
+			name:        "legacy_call",
+			raw:         "f86b03843b9aca0082c3509400000000000000000000000000000000c0ffee0082303984a9059cbb820a95a0b8a930eba6515adb21b92bbe44384f059caf900a3fbe3926f1a5852225cfbf80a054ad0b4661bcfdaea85c5dd8c1f0b2805174c544fb13472bf17adbc213b8daf0",
+			hash:        "0x3a8da93b174a7e2cf615df9060c7d38fd51825622e1fbd8e6a3bfb859490b74c",
+			signingHash: "0x117d7d9b961a9c1bbe2c5ddd03dd11dec4f35a1b05a34ba0b83e3b3083698077",
+			tx: &Transaction{
+				Type:      LegacyTxType,
+				Nonce:     3,
+				GasPrice:  big.NewInt(1000000000),
+				GasLimit:  50000,
+				Recipient: "0x00000000000000000000000000000000c0ffee00",
+				Value:     big.NewInt(12345),
+				Data:      []byte{0xa9, 0x05, 0x9c, 0xbb},
+			},
+		},
+		{
+			name:        "legacy_deployment",
+			raw:         "f8538001830186a080808560006000f3820a96a08410ea7e8aedb2be8d518bd05461fad4f529b9b24352d5d9b431e3df98841ef5a05c43d07394a1041debf86b427fe6a05df858d0a8d4b5a38d8c329ef118354650",
+			hash:        "0xa91442b653edc6e1852ae73fcb37af3e9bfdf7d00161a02e1308992723e19467",
+			signingHash: "0xebd635ede48b63dd2ab20389611ebe429d356030d1defaee24a555027bb2fc35",
+			tx: &Transaction{
+				Type:     LegacyTxType,
+				GasPrice: big.NewInt(1),
+				GasLimit: 100000,
+				Value:    big.NewInt(0),
+				Contract: []byte{0x60, 0x00, 0x60, 0x00, 0xf3},
+			},
+		},
+		{
+			name:        "dynamic_fee_call",
+			raw:         "02f86682053907021e8252089400000000000000000000000000000000c0ffee0001820102c080a0e89e87a624900dd21aab98831d9837443ba6054179e964d44f8fcccdbc2615d1a06cbcb28a1431ac5ebe5bfb048241c6754abf5500ed46bfe0b4fd507268cc6d89",
+			hash:        "0x68d96af20cc6c285578bedb613b81a9e333b43d54d7b65a1791fec65426ea42f",
+			signingHash: "0x78e94a7d40e48946483e4b327d1bb407a55519b3590c838b0d3c52ce8f01c760",
+			tx: &Transaction{
+				Type:      DynamicFeeTxType,
+				Nonce:     7,
+				GasTipCap: big.NewInt(2),
+				GasFeeCap: big.NewInt(30),
+				GasLimit:  21000,
+				Recipient: "0x00000000000000000000000000000000c0ffee00",
+				Value:     big.NewInt(1),
+				Data:      []byte{0x01, 0x02},
+			},
+		},
+	}
+	sender := crypto.PubkeyToAddress(testKey.PublicKey)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := hex.DecodeString(tt.raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := DecodeTransaction(raw)
+			if err != nil {
+				t.Fatalf("decoding failed: %v", err)
+			}
+			if hash, err := decoded.Hash(); err != nil || hash.Hex() != tt.hash {
+				t.Errorf("hash %s (%v), want %s", hash.Hex(), err, tt.hash)
+			}
+			if hash, err := decoded.SigningHash(); err != nil || hash.Hex() != tt.signingHash {
+				t.Errorf("signing hash %s (%v), want %s", hash.Hex(), err, tt.signingHash)
+			}
+			if recovered, err := decoded.RecoverSender(); err != nil || recovered != sender {
+				t.Errorf("sender %s (%v), want %s", recovered.Hex(), err, sender.Hex())
+			}
+			if encoded, err := decoded.MarshalBinary(); err != nil || !bytes.Equal(encoded, raw) {
+				t.Errorf("re-encoded as %x (%v)", encoded, err)
+			}
+
+			// Signatures are deterministic (RFC 6979), so signing the same
+			// fields gives the same encoding
+			if err := SignTransaction(tt.tx, testKey); err != nil {
+				t.Fatalf("signing failed: %v", err)
+			}
+			if encoded, err := tt.tx.MarshalBinary(); err != nil || !bytes.Equal(encoded, raw) {
+				t.Errorf("signed as %x (%v)", encoded, err)
+			}
+		})
+	}
+}
+
+// TestNativeTransactionData checks that the input of a native transaction is
+// signed and survives encoding, so that it cannot be swapped for another.
+func TestNativeTransactionData(t *testing.T) {
+	tx := &Transaction{
+		Nonce:     1,
+		Recipient: "0x00000000000000000000000000000000c0ffee00",
+		Value:     big.NewInt(5),
+		Data:      []byte{0xde, 0xad, 0xbe, 0xef},
+	}
+	if err := SignTransaction(tx, testKey); err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeTransaction(encoded)
+	if err != nil {
+		t.Fatalf("decoding failed: %v", err)
+	}
+	if !bytes.Equal(decoded.Data, tx.Data) {
+		t.Errorf("data decoded as %x, want %x", decoded.Data, tx.Data)
+	}
+	if err := decoded.verifySender(); err != nil {
+		t.Fatalf("signature rejected: %v", err)
+	}
+
+	hash, _ := tx.Hash()
+	decoded.Data = []byte{0x00}
+	if tamperedHash, _ := decoded.Hash(); tamperedHash == hash {
+		t.Error("hash does not cover data")
+	}
+	decoded.Sender = tx.Sender
+	if err := decoded.verifySender(); !errors.Is(err, ErrSenderMismatch) {
+		t.Errorf("error %v for altered data, want %v", err, ErrSenderMismatch)
+	}
+}
+
+// TestEthereumTransactionNativeFields checks that fields an Ethereum
+// transaction's signature does not cover make it invalid rather than being
+// run unsigned.
+func TestEthereumTransactionNativeFields(t *testing.T) {
+	recipient := "0x00000000000000000000000000000000c0ffee00"
+	tests := []struct {
+		name   string
+		modify func(tx *Transaction)
+	}{
+		{"function_signature", func(tx *Transaction) { tx.FunctionSignature = "transfer" }},
+		{"arguments", func(tx *Transaction) { tx.Arguments = []interface{}{"1"} }},
+		{"abi", func(tx *Transaction) { tx.ABI = []byte("[]") }},
+		{"payload", func(tx *Transaction) { tx.Payload = "rent" }},
+		{"contract_on_call", func(tx *Transaction) { tx.Contract = []byte{0x00} }},
+		{"data_on_deployment", func(tx *Transaction) { tx.Recipient, tx.Contract, tx.Data = "", []byte{0x00}, []byte{0x01} }},
+	}
+	for _, txType := range []TxType{LegacyTxType, DynamicFeeTxType} {
+		for _, tt := range tests {
+			t.Run(string(txType)+"/"+tt.name, func(t *testing.T) {
+				tx := &Transaction{Type: txType, Recipient: recipient, GasPrice: big.NewInt(1), Value: big.NewInt(1)}
+				if err := SignTransaction(tx, testKey); err != nil {
+					t.Fatal(err)
+				}
+
+				// The fields are set after signing, as the signature would not
+				// cover them
+				tt.modify(tx)
+				if err := newTestChain(t, 0).AddTransaction(tx); !errors.Is(err, ErrNativeFields) {
+					t.Errorf("error %v, want %v", err, ErrNativeFields)
+				}
+				if err := SignTransaction(tx, testKey); !errors.Is(err, ErrNativeFields) {
+					t.Errorf("signing error %v, want %v", err, ErrNativeFields)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package blockchain
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+
+	"smartley-contracts/merkle"
+	"smartley-contracts/types"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Header holds the fields of a block that its hash covers. The roots commit
+// to the block's transactions, to their receipts and to the state left by
+// executing them, so that none can be altered without changing the hash.
+type Header struct {
+	Index            int            `json:"index"`
+	Timestamp        string         `json:"timestamp"`
+	Proof            int            `json:"proof"`
+	Difficulty       *big.Int       `json:"difficulty"` // Expected number of hashes needed to find the proof
+	PreviousHash     string         `json:"previous_hash"`
+	Coinbase         common.Address `json:"coinbase"` // Account that mined the block
+	BaseFee          *big.Int       `json:"base_fee"` // Always zero, as the chain has no base fee
+	TransactionsRoot common.Hash    `json:"transactions_root"`
+	ReceiptsRoot     common.Hash    `json:"receipts_root"`
+	StateRoot        common.Hash    `json:"state_root"`
+}
+
+// MarshalBinary returns the canonical encoding of the header, the RLP list of
+// its fields in order.
+func (h *Header) MarshalBinary() ([]byte, error) {
+	return rlp.EncodeToBytes([]interface{}{
+		uint64(h.Index),
+		h.Timestamp,
+		uint64(h.Proof),
+		bigOrZero(h.Difficulty),
+		h.PreviousHash,
+		h.Coinbase,
+		bigOrZero(h.BaseFee),
+		h.TransactionsRoot,
+		h.ReceiptsRoot,
+		h.StateRoot,
+	})
+}
+
+// Hash returns the Keccak-256 hash of the header's canonical encoding.
+func (h *Header) Hash() common.Hash {
+	encoded, _ := h.MarshalBinary() // Fields of fixed types always encode
+	return crypto.Keccak256Hash(encoded)
+}
+
+// SealHash returns the hash of the header without its proof, which the proof
+// of work is computed over.
+func (h *Header) SealHash() common.Hash {
+	encoded, _ := rlp.EncodeToBytes([]interface{}{ // Fields of fixed types always encode
+		uint64(h.Index),
+		h.Timestamp,
+		bigOrZero(h.Difficulty),
+		h.PreviousHash,
+		h.Coinbase,
+		bigOrZero(h.BaseFee),
+		h.TransactionsRoot,
+		h.ReceiptsRoot,
+		h.StateRoot,
+	})
+	return crypto.Keccak256Hash(encoded)
+}
+
+// TransactionsRoot returns the root of the Merkle tree over the canonical
+// encodings of transactions, in block order.
+func TransactionsRoot(transactions []*Transaction) (common.Hash, error) {
+	items := make([][]byte, len(transactions))
+	for i, tx := range transactions {
+		encoded, err := tx.MarshalBinary()
+		if err != nil {
+			return common.Hash{}, err
+		}
+		items[i] = encoded
+	}
+	return merkle.Root(items), nil
+}
+
+// ReceiptsRoot returns the root of the Merkle tree over the canonical
+// encodings of receipts, in block order.
+func ReceiptsRoot(receipts []*Receipt) common.Hash {
+	items := make([][]byte, len(receipts))
+	for i, receipt := range receipts {
+		items[i] = receipt.encode()
+	}
+	return merkle.Root(items)
+}
+
+// StateRoot returns the root of the Merkle tree over the accounts of state,
+// ordered by address. Each leaf encodes an account's address, nonce, balance,
+// the hashes of its code and ABI, and the root of the Merkle tree over its
+// storage slots, ordered by key.
+func StateRoot(state map[common.Address]*types.Storage) common.Hash {
+	addresses := make([]common.Address, 0, len(state))
+	for address := range state {
+		addresses = append(addresses, address)
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		return bytes.Compare(addresses[i][:], addresses[j][:]) < 0
+	})
+
+	items := make([][]byte, len(addresses))
+	for i, address := range addresses {
+		account := state[address]
+		items[i], _ = rlp.EncodeToBytes([]interface{}{ // Fields of fixed types always encode
+			address,
+			account.GetNonce(),
+			account.GetBalance().ToBig(),
+			crypto.Keccak256Hash(account.GetBytecode()),
+			crypto.Keccak256Hash(account.GetABI()),
+			storageRoot(account),
+		})
+	}
+	return merkle.Root(items)
+}
+
+// storageRoot returns the root of the Merkle tree over an account's non-zero
+// storage slots, ordered by key.
+func storageRoot(account *types.Storage) common.Hash {
+	var keys []common.Hash
+	values := make(map[common.Hash]common.Hash)
+	account.ForEachState(func(key, value common.Hash) {
+		keys = append(keys, key)
+		values[key] = value
+	})
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(keys[i][:], keys[j][:]) < 0
+	})
+
+	items := make([][]byte, len(keys))
+	for i, key := range keys {
+		value := values[key]
+		items[i] = append(append([]byte{}, key[:]...), value[:]...)
+	}
+	return merkle.Root(items)
+}
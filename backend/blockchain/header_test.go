@@ -0,0 +1,109 @@
+package blockchain
+
+import (
+	"math/big"
+	"testing"
+
+	"smartley-contracts/contracts"
+	"smartley-contracts/types"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/holiman/uint256"
+)
+
+// TestRootsCommitToContents alters the last block's transactions, receipts and
+// the state it left, and checks that each change moves the matching root, and
+// only that one, and so the block's hash.
+func TestRootsCommitToContents(t *testing.T) {
+	sender := crypto.PubkeyToAddress(testKey.PublicKey)
+	recipient := common.HexToAddress("0x000000000000000000000000000000000000b0b0")
+	tests := []struct {
+		name   string
+		root   string // The root the change must move
+		modify func(block *Block, state map[common.Address]*types.Storage)
+	}{
+		{"transaction_value", "transactions", func(block *Block, state map[common.Address]*types.Storage) {
+			block.Transactions[0].Value = big.NewInt(101)
+		}},
+		{"transaction_nonce", "transactions", func(block *Block, state map[common.Address]*types.Storage) { block.Transactions[0].Nonce++ }},
+		{"transaction_signature", "transactions", func(block *Block, state map[common.Address]*types.Storage) {
+			block.Transactions[0].Signature[0] ^= 1
+		}},
+		{"extra_transaction", "transactions", func(block *Block, state map[common.Address]*types.Storage) {
+			block.Transactions = append(block.Transactions, block.Transactions[0])
+		}},
+		{"receipt_status", "receipts", func(block *Block, state map[common.Address]*types.Storage) {
+			block.Receipts[0].Status = ReceiptStatusFailed
+		}},
+		{"receipt_gas", "receipts", func(block *Block, state map[common.Address]*types.Storage) { block.Receipts[0].GasUsed++ }},
+		{"receipt_log", "receipts", func(block *Block, state map[common.Address]*types.Storage) {
+			block.Receipts[0].Logs = append(block.Receipts[0].Logs, &contracts.Log{Address: recipient})
+		}},
+		{"account_balance", "state", func(block *Block, state map[common.Address]*types.Storage) {
+			state[recipient].SetBalance(uint256.NewInt(1))
+		}},
+		{"account_nonce", "state", func(block *Block, state map[common.Address]*types.Storage) {
+			state[sender].SetNonce(state[sender].GetNonce() + 1)
+		}},
+		{"account_code", "state", func(block *Block, state map[common.Address]*types.Storage) {
+			state[recipient].SetBytecode([]byte{0x00})
+		}},
+		{"account_storage", "state", func(block *Block, state map[common.Address]*types.Storage) {
+			state[recipient].SetState(common.Hash{}, common.HexToHash("0x01"))
+		}},
+		{"new_account", "state", func(block *Block, state map[common.Address]*types.Storage) {
+			state[common.HexToAddress("0x01")] = types.NewStorage()
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newValidatedChain(t)
+			block := b.chain[len(b.chain)-1]
+			state := make(map[common.Address]*types.Storage, len(b.State()))
+			for address, account := range b.State() {
+				state[address] = account.Copy()
+			}
+
+			// The last block's roots are those of its contents and of the
+			// current state
+			roots := func() map[string]common.Hash {
+				transactionsRoot, err := TransactionsRoot(block.Transactions)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return map[string]common.Hash{
+					"transactions": transactionsRoot,
+					"receipts":     ReceiptsRoot(block.Receipts),
+					"state":        StateRoot(state),
+				}
+			}
+			before := roots()
+			if before["transactions"] != block.TransactionsRoot || before["receipts"] != block.ReceiptsRoot || before["state"] != block.StateRoot {
+				t.Fatal("roots differ from the header")
+			}
+			tt.modify(block, state)
+			after := roots()
+			for name, root := range before {
+				if changed := after[name] != root; changed != (name == tt.root) {
+					t.Errorf("%s root changed: %v", name, changed)
+				}
+			}
+
+			// Committing the header to the new root changes the block hash
+			hash := block.Header.Hash()
+			header := block.Header
+			switch tt.root {
+			case "transactions":
+				header.TransactionsRoot = after["transactions"]
+			case "receipts":
+				header.ReceiptsRoot = after["receipts"]
+			case "state":
+				header.StateRoot = after["state"]
+			}
+			if header.Hash() == hash {
+				t.Errorf("block hash unchanged by the new %s root", tt.root)
+			}
+		})
+	}
+}
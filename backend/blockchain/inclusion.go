@@ -0,0 +1,120 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"smartley-contracts/merkle"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// ProofKind names the tree of a block an InclusionProof refers to.
+type ProofKind string
+
+const (
+	TransactionProof ProofKind = "transaction"
+	ReceiptProof     ProofKind = "receipt"
+)
+
+var (
+	// ErrHeaderMismatch is returned when the header in an inclusion proof is
+	// not the header of the block it is checked against.
+	ErrHeaderMismatch = errors.New("header does not match block hash")
+
+	// ErrNotIncluded is returned when an inclusion proof does not lead from
+	// its item to the root in its header.
+	ErrNotIncluded = errors.New("item is not included in block")
+)
+
+// InclusionProof proves that a transaction, or a transaction's receipt, was
+// recorded in a block. It is self-contained: checking it needs only the hash
+// of the block, which the verifier must obtain from a source it trusts.
+type InclusionProof struct {
+	Kind   ProofKind     `json:"kind"`
+	Header Header        `json:"header"` // Header of the block, whose roots the proof leads to
+	Item   hexutil.Bytes `json:"item"`   // Canonical encoding of the transaction or receipt
+	Proof  merkle.Proof  `json:"proof"`
+}
+
+// ProveTransaction returns the proof that the transaction at txIndex is part
+// of the block with the given index.
+func (b *Blockchain) ProveTransaction(blockIndex, txIndex int) (*InclusionProof, error) {
+	block, err := b.blockAt(blockIndex)
+	if err != nil {
+		return nil, err
+	}
+	items := make([][]byte, len(block.Transactions))
+	for i, tx := range block.Transactions {
+		if items[i], err = tx.MarshalBinary(); err != nil {
+			return nil, err
+		}
+	}
+	return newInclusionProof(TransactionProof, block, items, txIndex)
+}
+
+// ProveReceipt returns the proof that the receipt of the transaction at
+// txIndex is part of the block with the given index.
+func (b *Blockchain) ProveReceipt(blockIndex, txIndex int) (*InclusionProof, error) {
+	block, err := b.blockAt(blockIndex)
+	if err != nil {
+		return nil, err
+	}
+	items := make([][]byte, len(block.Receipts))
+	for i, receipt := range block.Receipts {
+		items[i] = receipt.encode()
+	}
+	return newInclusionProof(ReceiptProof, block, items, txIndex)
+}
+
+// newInclusionProof returns the proof of kind that items[index] is part of block.
+func newInclusionProof(kind ProofKind, block *Block, items [][]byte, index int) (*InclusionProof, error) {
+	if index < 0 || index >= len(items) {
+		return nil, fmt.Errorf("transaction %d not found in block %d", index, block.Index)
+	}
+	proof, err := merkle.Prove(items, index)
+	if err != nil {
+		return nil, err
+	}
+	return &InclusionProof{
+		Kind:   kind,
+		Header: block.Header,
+		Item:   items[index],
+		Proof:  *proof,
+	}, nil
+}
+
+// Verify checks that the proof's item is part of the block with the given
+// hash, in hex as Blockchain.Hash returns it: that the proof's header hashes
+// to blockHash, and that the proof leads from the item to the matching root
+// of the header.
+func (p *InclusionProof) Verify(blockHash string) error {
+	hash := p.Header.Hash()
+	if hex.EncodeToString(hash[:]) != strings.TrimPrefix(strings.ToLower(blockHash), "0x") {
+		return ErrHeaderMismatch
+	}
+
+	root := p.Header.TransactionsRoot
+	switch p.Kind {
+	case TransactionProof:
+	case ReceiptProof:
+		root = p.Header.ReceiptsRoot
+	default:
+		return fmt.Errorf("unknown proof kind %q", p.Kind)
+	}
+	if !merkle.Verify(root, p.Item, &p.Proof) {
+		return ErrNotIncluded
+	}
+	return nil
+}
+
+// blockAt returns the block with the given index.
+func (b *Blockchain) blockAt(index int) (*Block, error) {
+	chain := b.Chain()
+	if index < 1 || index > len(chain) {
+		return nil, fmt.Errorf("block %d not found", index)
+	}
+	return chain[index-1], nil
+}
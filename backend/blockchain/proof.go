@@ -1,60 +1,191 @@
 package blockchain
 
 import (
-	"bytes"
 	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
 	"math/big"
 	"strconv"
 	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var (
+	// GenesisDifficulty is the difficulty of the first block, the expected
+	// number of hashes needed to find its proof.
+	GenesisDifficulty = big.NewInt(1 << 16)
+
+	// MinimumDifficulty is the lowest difficulty the adjustment can reach.
+	MinimumDifficulty = big.NewInt(1 << 10)
 )
 
-func (b *Blockchain) ProofOfWork() int {
-	var proof int
-	var target big.Int
+const (
+	// difficultyWindow is the number of recent blocks whose timestamps the
+	// difficulty adjustment measures the block interval over.
+	difficultyWindow = 10
 
-	// Update the target value initialization
-	target.Lsh(big.NewInt(1), uint(256-24)) // Change the 24 to adjust the difficulty
+	// maxAdjustmentFactor bounds how much the difficulty changes from one
+	// block to the next, either way.
+	maxAdjustmentFactor = 4
+)
+
+// ErrInvalidProofOfWork is returned for a block whose proof does not meet the
+// proof-of-work target.
+var ErrInvalidProofOfWork = errors.New("invalid proof of work")
 
-	for {
-		var hash big.Int
-		hash.SetBytes(b.HashWithProof(proof))
+// ProofOfWork finds the proof for a candidate block: the lowest value of
+// header.Proof for which PowHash is below the target. As PowHash covers the
+// rest of the header, the proof is only valid for the block it was found for.
+func ProofOfWork(header *Header) int {
+	target := powTarget(header.Difficulty)
+	hasher := newPowHasher(header.SealHash())
 
-		if hash.Cmp(&target) == -1 {
-			break
+	var value big.Int
+	for proof := 0; ; proof++ {
+		value.SetBytes(hasher.hash(proof))
+		if value.Cmp(target) < 0 {
+			return proof
 		}
+	}
+}
 
-		proof++
+// VerifyProofOfWork checks that a block's proof meets the proof-of-work
+// target its difficulty sets, for the rest of its header.
+func VerifyProofOfWork(header *Header) error {
+	if header.Difficulty == nil || header.Difficulty.Sign() <= 0 {
+		return fmt.Errorf("%w: block %d has no difficulty", ErrInvalidProofOfWork, header.Index)
 	}
+	value := new(big.Int).SetBytes(PowHash(header))
+	if value.Cmp(powTarget(header.Difficulty)) >= 0 {
+		return fmt.Errorf("%w: block %d, proof %d", ErrInvalidProofOfWork, header.Index, header.Proof)
+	}
+	return nil
+}
+
+// PowHash returns the hash a block's proof of work is judged by: the SHA-256
+// hash of the header's SealHash followed by the proof as a big-endian 64-bit
+// integer.
+func PowHash(header *Header) []byte {
+	return newPowHasher(header.SealHash()).hash(header.Proof)
+}
+
+// powHasher computes PowHash for one header and any number of proofs, without
+// allocating for each.
+type powHasher struct {
+	sha    hash.Hash
+	input  [common.HashLength + 8]byte // Seal hash, then proof
+	output [sha256.Size]byte
+}
+
+func newPowHasher(sealHash common.Hash) *powHasher {
+	hasher := &powHasher{sha: sha256.New()}
+	copy(hasher.input[:], sealHash[:])
+	return hasher
+}
 
-	return proof
+// hash returns PowHash for the given proof. The result is overwritten by the
+// next call.
+func (h *powHasher) hash(proof int) []byte {
+	binary.BigEndian.PutUint64(h.input[common.HashLength:], uint64(proof))
+	h.sha.Reset()
+	h.sha.Write(h.input[:])
+	return h.sha.Sum(h.output[:0])
 }
 
-func (b *Blockchain) HashWithProof(proof int) []byte {
-	hash := sha256.New()
+// powTarget returns the value a proof-of-work hash must be below for the
+// given difficulty: 2^256 / difficulty, so that difficulty is the expected
+// number of hashes needed to find a proof.
+func powTarget(difficulty *big.Int) *big.Int {
+	target := new(big.Int).Lsh(big.NewInt(1), 256)
+	return target.Div(target, difficulty)
+}
+
+// CalcDifficulty returns the difficulty of the block following chain, for
+// blocks to be mined interval apart. The hash rate is estimated as the work
+// done on the last difficultyWindow blocks over the time they took, and the
+// difficulty set to the work that rate does in interval. It changes by at
+// most maxAdjustmentFactor from the last block's, either way, and does not
+// fall below MinimumDifficulty.
+func CalcDifficulty(chain []*Block, interval time.Duration) *big.Int {
+	if len(chain) == 0 {
+		return new(big.Int).Set(GenesisDifficulty)
+	}
+	parent := chain[len(chain)-1]
+	start := len(chain) - 1 - difficultyWindow
+	if start < 0 {
+		start = 0
+	}
+	if start == len(chain)-1 {
+		return new(big.Int).Set(parent.Difficulty)
+	}
+
+	// Timestamps are in whole seconds, so blocks mined within the same
+	// second count as a second apart
+	elapsed := timestamp(parent) - timestamp(chain[start])
+	if elapsed < 1 {
+		elapsed = 1
+	}
+	work := TotalDifficulty(chain[start+1:])
+	difficulty := work.Mul(work, big.NewInt(int64(interval)))
+	difficulty.Div(difficulty, big.NewInt(elapsed*int64(time.Second)))
+
+	upper := new(big.Int).Mul(parent.Difficulty, big.NewInt(maxAdjustmentFactor))
+	lower := new(big.Int).Div(parent.Difficulty, big.NewInt(maxAdjustmentFactor))
+	switch {
+	case difficulty.Cmp(upper) > 0:
+		difficulty = upper
+	case difficulty.Cmp(lower) < 0:
+		difficulty = lower
+	}
+	if difficulty.Cmp(MinimumDifficulty) < 0 {
+		difficulty.Set(MinimumDifficulty)
+	}
+	return difficulty
+}
 
-	data := bytes.Join(
-		[][]byte{
-			[]byte(strconv.Itoa(proof)),
-			[]byte(b.LastBlock().PreviousHash),
-		},
-		[]byte{},
-	)
+// TotalDifficulty returns the sum of the difficulties of blocks: the work that
+// went into the chain they form.
+func TotalDifficulty(blocks []*Block) *big.Int {
+	total := new(big.Int)
+	for _, block := range blocks {
+		if block.Difficulty != nil {
+			total.Add(total, block.Difficulty)
+		}
+	}
+	return total
+}
 
-	hash.Write(data)
+// TotalDifficulty returns the total difficulty of the chain.
+func (b *Blockchain) TotalDifficulty() *big.Int {
+	chain := b.Chain()
+	if len(chain) == 0 {
+		return new(big.Int)
+	}
+	return new(big.Int).Set(chain[len(chain)-1].TotalDifficulty)
+}
 
-	return hash.Sum(nil)
+// timestamp returns the time a block was mined at, in Unix seconds.
+func timestamp(block *Block) int64 {
+	seconds, _ := strconv.ParseInt(block.Timestamp, 10, 64)
+	return seconds
 }
 
 func (b *Blockchain) LastBlock() *Block {
-	if len(b.chain) == 0 {
+	chain := b.Chain()
+	if len(chain) == 0 {
 		return &Block{
-			Index:        0,
-			Timestamp:    strconv.FormatInt(time.Now().Unix(), 10),
+			Header: Header{
+				Index:        0,
+				Timestamp:    strconv.FormatInt(time.Now().Unix(), 10),
+				Proof:        0,
+				PreviousHash: "",
+			},
 			Transactions: []*Transaction{},
-			Proof:        0,
-			PreviousHash: "",
 		}
 	}
 
-	return b.chain[len(b.chain)-1]
+	return chain[len(chain)-1]
 }
@@ -0,0 +1,101 @@
+package blockchain
+
+import (
+	"errors"
+	"math/big"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// TestVerifyProofOfWork checks that a found proof is valid for its header
+// only, and only at the difficulty it was found for.
+func TestVerifyProofOfWork(t *testing.T) {
+	newHeader := func() *Header {
+		return &Header{
+			Index:        3,
+			Timestamp:    "1700000000",
+			Difficulty:   new(big.Int).Set(GenesisDifficulty),
+			PreviousHash: "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+			StateRoot:    common.HexToHash("0x01"),
+		}
+	}
+	mined := newHeader()
+	mined.Proof = ProofOfWork(mined)
+	if err := VerifyProofOfWork(mined); err != nil {
+		t.Fatalf("found proof rejected: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(h *Header)
+	}{
+		{"lower_proof", func(h *Header) { h.Proof-- }},
+		{"index", func(h *Header) { h.Index++ }},
+		{"timestamp", func(h *Header) { h.Timestamp = "1700000001" }},
+		{"previous_hash", func(h *Header) { h.PreviousHash = "00" + h.PreviousHash[2:] }},
+		{"coinbase", func(h *Header) { h.Coinbase[0] ^= 1 }},
+		{"base_fee", func(h *Header) { h.BaseFee = big.NewInt(1) }},
+		{"transactions_root", func(h *Header) { h.TransactionsRoot[0] ^= 1 }},
+		{"receipts_root", func(h *Header) { h.ReceiptsRoot[0] ^= 1 }},
+		{"state_root", func(h *Header) { h.StateRoot[0] ^= 1 }},
+		{"higher_difficulty", func(h *Header) { h.Difficulty = new(big.Int).Lsh(big.NewInt(1), 128) }},
+		{"zero_difficulty", func(h *Header) { h.Difficulty = new(big.Int) }},
+		{"no_difficulty", func(h *Header) { h.Difficulty = nil }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := newHeader()
+			header.Proof = mined.Proof
+			tt.modify(header)
+			if err := VerifyProofOfWork(header); !errors.Is(err, ErrInvalidProofOfWork) {
+				t.Errorf("error %v, want %v", err, ErrInvalidProofOfWork)
+			}
+		})
+	}
+}
+
+// testChain returns n blocks of the given difficulty, mined spacing seconds apart.
+func testChain(n int, spacing int64, difficulty *big.Int) []*Block {
+	chain := make([]*Block, n)
+	for i := range chain {
+		chain[i] = &Block{Header: Header{
+			Index:      i + 1,
+			Timestamp:  strconv.FormatInt(1700000000+int64(i)*spacing, 10),
+			Difficulty: difficulty,
+		}}
+	}
+	return chain
+}
+
+// TestCalcDifficulty checks the adjustment towards the block interval and its
+// bounds.
+func TestCalcDifficulty(t *testing.T) {
+	d := big.NewInt(1 << 20)
+	tests := []struct {
+		name     string
+		chain    []*Block
+		interval time.Duration
+		want     *big.Int
+	}{
+		{"genesis", nil, 10 * time.Second, GenesisDifficulty},
+		{"after_genesis", testChain(1, 0, d), 10 * time.Second, d},
+		{"on_target", testChain(11, 10, d), 10 * time.Second, d},
+		{"twice_as_fast", testChain(11, 5, d), 10 * time.Second, big.NewInt(1 << 21)},
+		{"twice_as_slow", testChain(11, 20, d), 10 * time.Second, big.NewInt(1 << 19)},
+		{"longer_interval", testChain(11, 10, d), 20 * time.Second, big.NewInt(1 << 21)},
+		{"window_only", append(testChain(1, 0, big.NewInt(1)), testChain(11, 10, d)...), 10 * time.Second, d},
+		{"same_second_clamped_up", testChain(11, 0, d), 10 * time.Second, big.NewInt(1 << 22)},
+		{"much_slower_clamped_down", testChain(11, 1000, d), 10 * time.Second, big.NewInt(1 << 18)},
+		{"minimum", testChain(11, 1000, MinimumDifficulty), 10 * time.Second, MinimumDifficulty},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CalcDifficulty(tt.chain, tt.interval); got.Cmp(tt.want) != 0 {
+				t.Errorf("difficulty %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
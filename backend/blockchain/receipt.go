@@ -0,0 +1,65 @@
+package blockchain
+
+import (
+	"smartley-contracts/contracts"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	ReceiptStatusFailed     = uint64(0)
+	ReceiptStatusSuccessful = uint64(1)
+)
+
+// Receipt records the outcome of executing one of a block's transactions,
+// including the events its contract code emitted.
+type Receipt struct {
+	TransactionHash  common.Hash      `json:"transaction_hash"`
+	TransactionIndex int              `json:"transaction_index"`
+	Status           uint64           `json:"status"`
+	GasUsed          uint64           `json:"gas_used"`
+	ContractAddress  string           `json:"contract_address,omitempty"`
+	Logs             []*contracts.Log `json:"logs"`
+	Error            string           `json:"error,omitempty"`
+}
+
+// newReceipt builds the receipt for a transaction executed with the given result
+// and error. result may be nil when execution never started.
+func newReceipt(result *contracts.ExecutionResult, err error) *Receipt {
+	receipt := &Receipt{
+		Status: ReceiptStatusSuccessful,
+		Logs:   []*contracts.Log{},
+	}
+	if result != nil {
+		receipt.GasUsed = result.GasUsed
+		if result.Logs != nil {
+			receipt.Logs = result.Logs
+		}
+	}
+	if err != nil {
+		receipt.Status = ReceiptStatusFailed
+		receipt.Error = err.Error()
+	}
+	return receipt
+}
+
+// encode returns the canonical encoding of the receipt, committed to by the
+// receipts root of its block: the RLP list of its status, gas used, contract
+// address and error, and of the address, topics and data of each log. The
+// transaction's hash and index are left out, as the position of the receipt
+// in the block already determines them.
+func (r *Receipt) encode() []byte {
+	logs := make([]interface{}, len(r.Logs))
+	for i, log := range r.Logs {
+		logs[i] = []interface{}{log.Address, log.Topics, []byte(log.Data)}
+	}
+	encoded, _ := rlp.EncodeToBytes([]interface{}{ // Fields of fixed types always encode
+		r.Status,
+		r.GasUsed,
+		r.ContractAddress,
+		logs,
+		r.Error,
+	})
+	return encoded
+}
@@ -0,0 +1,50 @@
+package blockchain
+
+import (
+	"fmt"
+
+	"smartley-contracts/contracts"
+	"smartley-contracts/types"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// genesisState returns the accounts the chain starts with.
+func (b *Blockchain) genesisState() map[common.Address]*types.Storage {
+	state := make(map[common.Address]*types.Storage)
+	for address, balance := range b.config.GenesisAlloc {
+		account := types.NewStorage()
+		account.SetBalance(bigToWord(balance))
+		state[address] = account
+	}
+	return state
+}
+
+// TraceTransaction replays a mined transaction, identified by the index of its
+// block and its position in that block, reporting its execution to tracer.
+// The chain only keeps its latest state, so every transaction before it is
+// re-executed from the genesis state first. The chain itself is not modified.
+func (b *Blockchain) TraceTransaction(blockIndex, txIndex int, tracer contracts.Tracer) (*Receipt, error) {
+	chain := b.Chain()
+	if blockIndex < 1 || blockIndex > len(chain) {
+		return nil, fmt.Errorf("block %d not found", blockIndex)
+	}
+	target := chain[blockIndex-1]
+	if txIndex < 0 || txIndex >= len(target.Transactions) {
+		return nil, fmt.Errorf("transaction %d not found in block %d", txIndex, blockIndex)
+	}
+
+	state := b.genesisState()
+	for _, block := range chain[:blockIndex-1] {
+		for _, tx := range block.Transactions {
+			b.applyTransaction(state, tx, block, nil)
+		}
+	}
+	for _, tx := range target.Transactions[:txIndex] {
+		b.applyTransaction(state, tx, target, nil)
+	}
+	receipt := b.applyTransaction(state, target.Transactions[txIndex], target, tracer)
+	receipt.TransactionHash, _ = target.Transactions[txIndex].Hash()
+	receipt.TransactionIndex = txIndex
+	return receipt, nil
+}
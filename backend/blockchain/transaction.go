@@ -0,0 +1,202 @@
+package blockchain
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"smartley-contracts/contracts"
+	"smartley-contracts/types"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var (
+	// ErrMissingSignature is returned for a transaction submitted without a signature.
+	ErrMissingSignature = errors.New("transaction is not signed")
+
+	// ErrInvalidSignature is returned for a signature that is malformed or
+	// from which no public key can be recovered.
+	ErrInvalidSignature = errors.New("invalid transaction signature")
+
+	// ErrSenderMismatch is returned when a transaction names a sender other
+	// than the account that signed it.
+	ErrSenderMismatch = errors.New("sender does not match signature")
+
+	// ErrNonceTooLow is returned for a transaction whose nonce the sender has
+	// already used.
+	ErrNonceTooLow = errors.New("nonce too low")
+
+	// ErrNonceTooHigh is returned for a transaction mined before the
+	// transactions that use the sender's lower nonces.
+	ErrNonceTooHigh = errors.New("nonce too high")
+)
+
+// SigningHash returns the hash a transaction's sender signs. For a native
+// transaction it is the Keccak-256 hash of the RLP encoding of every field
+// that affects its execution, except the sender, which is recovered from the
+// signature. ChainID is included so that a transaction signed for one chain is
+// not valid on another. Ethereum transactions are signed as Ethereum defines.
+func (tx *Transaction) SigningHash() (common.Hash, error) {
+	if tx.Type != NativeTxType {
+		return tx.ethereumSigningHash()
+	}
+	arguments, err := json.Marshal(tx.Arguments)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("failed to encode arguments: %v", err)
+	}
+	encoded, err := rlp.EncodeToBytes([]interface{}{
+		ChainID,
+		tx.Nonce,
+		bigOrZero(tx.GasPrice),
+		tx.GasLimit,
+		AddressFromString(tx.Recipient),
+		bigOrZero(tx.Value),
+		tx.Payload,
+		tx.Contract,
+		tx.FunctionSignature,
+		tx.ABI,
+		arguments,
+		tx.Data,
+	})
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return crypto.Keccak256Hash(encoded), nil
+}
+
+// SignTransaction signs tx with key and sets its sender to the key's address.
+func SignTransaction(tx *Transaction, key *ecdsa.PrivateKey) error {
+	hash, err := tx.SigningHash()
+	if err != nil {
+		return err
+	}
+	signature, err := crypto.Sign(hash[:], key)
+	if err != nil {
+		return err
+	}
+	tx.Signature = signature
+	tx.Sender = crypto.PubkeyToAddress(key.PublicKey).Hex()
+	return nil
+}
+
+// RecoverSender returns the address of the account that signed tx. Like
+// Ethereum since Homestead, it rejects signatures with a high S value, so that
+// a signature cannot be altered into a second valid one.
+func (tx *Transaction) RecoverSender() (common.Address, error) {
+	if len(tx.Signature) == 0 {
+		return common.Address{}, ErrMissingSignature
+	}
+	if len(tx.Signature) != crypto.SignatureLength {
+		return common.Address{}, fmt.Errorf("%w: length %d, want %d", ErrInvalidSignature, len(tx.Signature), crypto.SignatureLength)
+	}
+	r := new(big.Int).SetBytes(tx.Signature[:32])
+	s := new(big.Int).SetBytes(tx.Signature[32:64])
+	if !crypto.ValidateSignatureValues(tx.Signature[64], r, s, true) {
+		return common.Address{}, ErrInvalidSignature
+	}
+
+	hash, err := tx.SigningHash()
+	if err != nil {
+		return common.Address{}, err
+	}
+	publicKey, err := crypto.SigToPub(hash[:], tx.Signature)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	return crypto.PubkeyToAddress(*publicKey), nil
+}
+
+// verifySender checks tx's signature and sets its sender to the signer. A
+// sender already named in tx must be the signer.
+func (tx *Transaction) verifySender() error {
+	sender, err := tx.RecoverSender()
+	if err != nil {
+		return err
+	}
+	if tx.Sender != "" && AddressFromString(tx.Sender) != sender {
+		return fmt.Errorf("%w: sender %s, signed by %s", ErrSenderMismatch, tx.Sender, sender.Hex())
+	}
+	tx.Sender = sender.Hex()
+	return nil
+}
+
+// checkNonce reports whether tx uses the next nonce of its sender in state.
+func checkNonce(state map[common.Address]*types.Storage, tx *Transaction) error {
+	nonce := accountNonce(state, AddressFromString(tx.Sender))
+	switch {
+	case tx.Nonce < nonce:
+		return fmt.Errorf("%w: address %s, tx %d, state %d", ErrNonceTooLow, tx.Sender, tx.Nonce, nonce)
+	case tx.Nonce > nonce:
+		return fmt.Errorf("%w: address %s, tx %d, state %d", ErrNonceTooHigh, tx.Sender, tx.Nonce, nonce)
+	}
+	return nil
+}
+
+// accountNonce returns the nonce of the account at address in state.
+func accountNonce(state map[common.Address]*types.Storage, address common.Address) uint64 {
+	if account, ok := state[address]; ok {
+		return account.GetNonce()
+	}
+	return 0
+}
+
+// GetTransaction looks up a transaction by its hash, among both the mined
+// transactions and those waiting in the pool. It returns the transaction with
+// its receipt and the block it was mined in, which are nil for a pending
+// transaction, or nil if there is no such transaction.
+func (b *Blockchain) GetTransaction(hash common.Hash) (*Transaction, *Receipt, *Block) {
+	for _, block := range b.Chain() {
+		for i, receipt := range block.Receipts {
+			if receipt.TransactionHash == hash {
+				return block.Transactions[i], receipt, block
+			}
+		}
+	}
+	for _, tx := range b.GetCurrentTransactions() {
+		if txHash, err := tx.Hash(); err == nil && txHash == hash {
+			return tx, nil, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+// isDeployment reports whether tx deploys a contract.
+func (tx *Transaction) isDeployment() bool {
+	if tx.Type != NativeTxType {
+		return tx.Recipient == ""
+	}
+	return len(tx.Contract) > 0
+}
+
+// effectiveGasPrice returns the price per unit of gas tx pays. The chain has no
+// base fee, so an EIP-1559 transaction pays its priority fee, up to its fee cap.
+func (tx *Transaction) effectiveGasPrice() *big.Int {
+	if tx.Type != DynamicFeeTxType {
+		return tx.GasPrice
+	}
+	if bigOrZero(tx.GasTipCap).Cmp(bigOrZero(tx.GasFeeCap)) > 0 {
+		return tx.GasFeeCap
+	}
+	return tx.GasTipCap
+}
+
+// gasLimit returns the gas available to tx.
+func (tx *Transaction) gasLimit() uint64 {
+	if tx.GasLimit == 0 {
+		return contracts.DefaultGasLimit
+	}
+	return tx.GasLimit
+}
+
+// bigOrZero returns value, or zero if it is nil.
+func bigOrZero(value *big.Int) *big.Int {
+	if value == nil {
+		return new(big.Int)
+	}
+	return value
+}
@@ -0,0 +1,175 @@
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	"smartley-contracts/types"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// maxFutureDrift is how far ahead of the validating node's clock a block's
+// timestamp may be.
+const maxFutureDrift = 15 * time.Second
+
+// ValidationReport is the result of ValidateChain.
+type ValidationReport struct {
+	Valid           bool             `json:"valid"`
+	BlocksChecked   int              `json:"blocks_checked"`   // Blocks that passed validation
+	StateRoot       common.Hash      `json:"state_root"`       // Root of the state after the last block that passed
+	TotalDifficulty *big.Int         `json:"total_difficulty"` // Total difficulty of the blocks that passed
+	Failure         *ValidationError `json:"failure,omitempty"`
+}
+
+// ValidationError describes the first block of a chain that fails validation.
+type ValidationError struct {
+	BlockIndex int    `json:"block_index"`
+	BlockHash  string `json:"block_hash"`
+	Reason     string `json:"reason"`
+	Err        error  `json:"-"`
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("block %d (%s): %s", e.BlockIndex, e.BlockHash, e.Reason)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// ValidateChain checks the whole chain from the genesis block: that each
+// block links to its parent's hash, has a timestamp no earlier than its
+// parent's and not in the future, carries the difficulty the adjustment
+// algorithm gives and a proof meeting it, and that every transaction is
+// properly signed. It re-executes every transaction from the genesis state
+// and checks the results against each block's transactions, receipts and
+// state roots. Validation stops at the first failing block, which the report
+// describes. The chain itself is not modified, and blocks mined while it is
+// validated are not checked.
+func (b *Blockchain) ValidateChain() *ValidationReport {
+	state := b.genesisState()
+	report := &ValidationReport{
+		Valid:           true,
+		StateRoot:       StateRoot(state),
+		TotalDifficulty: new(big.Int),
+	}
+	chain, now := b.Chain(), time.Now()
+	for i, block := range chain {
+		if err := b.validateBlock(state, chain[:i], block, now); err != nil {
+			report.Valid = false
+			report.Failure = &ValidationError{
+				BlockIndex: block.Index,
+				BlockHash:  b.Hash(block),
+				Reason:     err.Error(),
+				Err:        err,
+			}
+			return report
+		}
+		report.BlocksChecked++
+		report.StateRoot = block.StateRoot
+		report.TotalDifficulty.Add(report.TotalDifficulty, block.Difficulty)
+	}
+	return report
+}
+
+// validateBlock checks block, whose ancestors are parents, against state, the
+// state its parent left, and applies its transactions to state.
+func (b *Blockchain) validateBlock(state map[common.Address]*types.Storage, parents []*Block, block *Block, now time.Time) error {
+	// Linkage to the parent
+	if block.Index != len(parents)+1 {
+		return fmt.Errorf("index %d at height %d", block.Index, len(parents)+1)
+	}
+	previousHash := "1" // The genesis block's parent, which does not exist
+	var parent *Block
+	if len(parents) > 0 {
+		parent = parents[len(parents)-1]
+		previousHash = b.Hash(parent)
+	}
+	if block.PreviousHash != previousHash {
+		return fmt.Errorf("previous hash %s, parent hash %s", block.PreviousHash, previousHash)
+	}
+
+	// Timestamp
+	seconds, err := strconv.ParseInt(block.Timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp %q", block.Timestamp)
+	}
+	if parent != nil && seconds < timestamp(parent) {
+		return fmt.Errorf("timestamp %d before parent timestamp %d", seconds, timestamp(parent))
+	}
+	if time.Unix(seconds, 0).After(now.Add(maxFutureDrift)) {
+		return fmt.Errorf("timestamp %d is in the future", seconds)
+	}
+
+	// Difficulty and proof of work
+	if want := CalcDifficulty(parents, b.config.BlockInterval); block.Difficulty == nil || block.Difficulty.Cmp(want) != 0 {
+		return fmt.Errorf("difficulty %v, want %v", block.Difficulty, want)
+	}
+	if block.BaseFee == nil || block.BaseFee.Sign() != 0 {
+		return fmt.Errorf("base fee %v, want 0", block.BaseFee)
+	}
+	if err := VerifyProofOfWork(&block.Header); err != nil {
+		return err
+	}
+	totalDifficulty := new(big.Int).Add(TotalDifficulty(parents), block.Difficulty)
+	if block.TotalDifficulty == nil || block.TotalDifficulty.Cmp(totalDifficulty) != 0 {
+		return fmt.Errorf("total difficulty %v, want %v", block.TotalDifficulty, totalDifficulty)
+	}
+
+	// Transactions
+	if len(block.Receipts) != len(block.Transactions) {
+		return fmt.Errorf("%d receipts for %d transactions", len(block.Receipts), len(block.Transactions))
+	}
+	for i, tx := range block.Transactions {
+		if err := verifyMinedSender(tx); err != nil {
+			return fmt.Errorf("transaction %d: %w", i, err)
+		}
+	}
+	transactionsRoot, err := TransactionsRoot(block.Transactions)
+	if err != nil {
+		return err
+	}
+	if transactionsRoot != block.TransactionsRoot {
+		return fmt.Errorf("transactions root %s, want %s", block.TransactionsRoot.Hex(), transactionsRoot.Hex())
+	}
+
+	// Re-execution
+	receipts := make([]*Receipt, len(block.Transactions))
+	for i, tx := range block.Transactions {
+		receipts[i] = b.applyTransaction(state, tx, block, nil)
+		if !bytes.Equal(receipts[i].encode(), block.Receipts[i].encode()) {
+			return fmt.Errorf("receipt of transaction %d differs on re-execution", i)
+		}
+	}
+	if receiptsRoot := ReceiptsRoot(receipts); receiptsRoot != block.ReceiptsRoot {
+		return fmt.Errorf("receipts root %s, want %s", block.ReceiptsRoot.Hex(), receiptsRoot.Hex())
+	}
+	if stateRoot := StateRoot(state); stateRoot != block.StateRoot {
+		return fmt.Errorf("state root %s, want %s", block.StateRoot.Hex(), stateRoot.Hex())
+	}
+	return nil
+}
+
+// verifyMinedSender checks the sender of a mined transaction: a signed
+// transaction must be from its signer, and only the node itself, as the "0"
+// sender, sends unsigned ones.
+func verifyMinedSender(tx *Transaction) error {
+	if len(tx.Signature) == 0 {
+		if AddressFromString(tx.Sender) != (common.Address{}) {
+			return fmt.Errorf("%w: sender %s", ErrMissingSignature, tx.Sender)
+		}
+		return nil
+	}
+	sender, err := tx.RecoverSender()
+	if err != nil {
+		return err
+	}
+	if AddressFromString(tx.Sender) != sender {
+		return fmt.Errorf("%w: sender %s, signed by %s", ErrSenderMismatch, tx.Sender, sender.Hex())
+	}
+	return nil
+}
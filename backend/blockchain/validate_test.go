@@ -0,0 +1,73 @@
+package blockchain
+
+import (
+	"math/big"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// newValidatedChain returns a chain of three blocks, the last two holding a
+// transfer each, after checking that it validates.
+func newValidatedChain(t *testing.T) *Blockchain {
+	t.Helper()
+	b := newTestChain(t, 1000)
+	recipient := common.HexToAddress("0x000000000000000000000000000000000000b0b0").Hex()
+	sendSigned(t, b, &Transaction{Nonce: 0, Recipient: recipient, Value: big.NewInt(100)})
+	sendSigned(t, b, &Transaction{Nonce: 1, Recipient: recipient, Value: big.NewInt(200)})
+
+	report := b.ValidateChain()
+	if !report.Valid || report.BlocksChecked != 3 {
+		t.Fatalf("untampered chain: %+v, failure %v", report, report.Failure)
+	}
+	if report.StateRoot != StateRoot(b.State()) {
+		t.Errorf("state root %s, want %s", report.StateRoot.Hex(), StateRoot(b.State()).Hex())
+	}
+	return b
+}
+
+// TestValidateTamperedChain alters a valid chain in ways its linkage, proof of
+// work, roots and re-execution must each catch, and checks that validation
+// stops at the first block out of place.
+func TestValidateTamperedChain(t *testing.T) {
+	tests := []struct {
+		name    string
+		tamper  func(b *Blockchain)
+		block   int // Index of the first block that must fail
+		checked int // Blocks that pass before it
+	}{
+		{"transaction_value", func(b *Blockchain) { b.chain[1].Transactions[0].Value = big.NewInt(900) }, 2, 1},
+		{"removed_transaction", func(b *Blockchain) { b.chain[1].Transactions, b.chain[1].Receipts = nil, nil }, 2, 1},
+		{"receipt_gas", func(b *Blockchain) { b.chain[1].Receipts[0].GasUsed++ }, 2, 1},
+		{"receipt_status", func(b *Blockchain) { b.chain[2].Receipts[0].Status = ReceiptStatusFailed }, 3, 2},
+		{"state_root", func(b *Blockchain) { b.chain[1].StateRoot[0] ^= 1 }, 2, 1},
+		{"base_fee", func(b *Blockchain) { b.chain[1].BaseFee = big.NewInt(1) }, 2, 1},
+		{"difficulty", func(b *Blockchain) { b.chain[1].Difficulty = new(big.Int).Mul(b.chain[1].Difficulty, big.NewInt(2)) }, 2, 1},
+		{"total_difficulty", func(b *Blockchain) { b.chain[2].TotalDifficulty = big.NewInt(1) }, 3, 2},
+		{"previous_hash", func(b *Blockchain) { b.chain[2].PreviousHash = b.chain[0].PreviousHash }, 3, 2},
+		{"future_timestamp", func(b *Blockchain) {
+			b.chain[2].Timestamp = strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+		}, 3, 2},
+		{"removed_block", func(b *Blockchain) { b.chain = append(b.chain[:1:1], b.chain[2:]...) }, 3, 1},
+		{"swapped_blocks", func(b *Blockchain) { b.chain[1], b.chain[2] = b.chain[2], b.chain[1] }, 3, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newValidatedChain(t)
+			tt.tamper(b)
+
+			report := b.ValidateChain()
+			if report.Valid {
+				t.Fatal("tampered chain validated")
+			}
+			if report.Failure.BlockIndex != tt.block {
+				t.Errorf("failed at block %d (%s), want block %d", report.Failure.BlockIndex, report.Failure.Reason, tt.block)
+			}
+			if report.BlocksChecked != tt.checked {
+				t.Errorf("%d blocks checked, want %d", report.BlocksChecked, tt.checked)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package contracts
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+var (
+	// errorSelector and panicSelector identify the revert payloads emitted by
+	// require/revert with a message and by Solidity's built-in checks.
+	errorSelector = []byte{0x08, 0xc3, 0x79, 0xa0} // Error(string)
+	panicSelector = []byte{0x4e, 0x48, 0x7b, 0x71} // Panic(uint256)
+)
+
+// panicReasons describes the Panic(uint256) codes defined by the Solidity compiler.
+var panicReasons = map[uint64]string{
+	0x00: "generic compiler inserted panic",
+	0x01: "assert(false)",
+	0x11: "arithmetic underflow or overflow",
+	0x12: "division or modulo by zero",
+	0x21: "enum overflow",
+	0x22: "invalid encoded storage byte array accessed",
+	0x31: "pop from an empty array",
+	0x32: "array index out of bounds",
+	0x41: "memory allocation overflow",
+	0x51: "call to a zero-initialized variable of internal function type",
+}
+
+// ParseArgs converts arguments given as strings, as they arrive in API requests,
+// into the Go values the abi package packs for inputs. Integers are decimal;
+// addresses, bytes and fixed-size bytes are 0x-prefixed hex.
+func ParseArgs(inputs abi.Arguments, values []string) ([]interface{}, error) {
+	if len(values) != len(inputs) {
+		return nil, fmt.Errorf("expected %d arguments, got %d", len(inputs), len(values))
+	}
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		arg, err := parseArg(inputs[i].Type, value)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d (%s): %v", i, inputs[i].Name, err)
+		}
+		args[i] = arg
+	}
+	return args, nil
+}
+
+// parseArg converts a single string argument into a value of ABI type t.
+func parseArg(t abi.Type, value string) (interface{}, error) {
+	switch t.T {
+	case abi.IntTy, abi.UintTy:
+		n, ok := new(big.Int).SetString(value, 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid integer %q", value)
+		}
+		if !inRange(t, n) {
+			return nil, fmt.Errorf("%s out of range for %s", value, t)
+		}
+		// Integers of up to 64 bits are packed from the matching Go type
+		switch goType := t.GetType(); {
+		case goType == reflect.TypeOf(n):
+			return n, nil
+		case t.T == abi.UintTy:
+			return reflect.ValueOf(n.Uint64()).Convert(goType).Interface(), nil
+		default:
+			return reflect.ValueOf(n.Int64()).Convert(goType).Interface(), nil
+		}
+	case abi.BoolTy:
+		return strconv.ParseBool(value)
+	case abi.StringTy:
+		return value, nil
+	case abi.AddressTy:
+		if !common.IsHexAddress(value) {
+			return nil, fmt.Errorf("invalid address %q", value)
+		}
+		return common.HexToAddress(value), nil
+	case abi.BytesTy:
+		return hexutil.Decode(value)
+	case abi.FixedBytesTy:
+		b, err := hexutil.Decode(value)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) != t.Size {
+			return nil, fmt.Errorf("expected %d bytes for %s, got %d", t.Size, t, len(b))
+		}
+		array := reflect.New(t.GetType()).Elem()
+		reflect.Copy(array, reflect.ValueOf(b))
+		return array.Interface(), nil
+	default:
+		return nil, fmt.Errorf("unsupported argument type %s", t)
+	}
+}
+
+// inRange reports whether n fits integer type t: [0, 2^size-1] when unsigned
+// and [-2^(size-1), 2^(size-1)-1] when signed.
+func inRange(t abi.Type, n *big.Int) bool {
+	if t.T == abi.UintTy {
+		return n.Sign() >= 0 && n.BitLen() <= t.Size
+	}
+	limit := new(big.Int).Lsh(big.NewInt(1), uint(t.Size-1))
+	return n.Cmp(new(big.Int).Neg(limit)) >= 0 && n.Cmp(limit) < 0
+}
+
+// decodeOutputs unpacks a RETURN buffer using the method's ABI outputs. A method
+// with a single output yields that value; several outputs yield a list in
+// declaration order.
+func decodeOutputs(method abi.Method, data []byte) (interface{}, error) {
+	if len(method.Outputs) == 0 {
+		return nil, nil
+	}
+	values, err := method.Outputs.Unpack(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode return data: %v", err)
+	}
+	if len(values) == 1 {
+		return toJSONValue(method.Outputs[0].Type, values[0]), nil
+	}
+	results := make([]interface{}, len(values))
+	for i, value := range values {
+		results[i] = toJSONValue(method.Outputs[i].Type, value)
+	}
+	return results, nil
+}
+
+// toJSONValue converts a value produced by the abi package into a form that
+// marshals cleanly to JSON. Integers become decimal strings so that 256-bit
+// values survive JavaScript clients, byte strings become 0x-prefixed hex and
+// tuples become objects keyed by their field names.
+func toJSONValue(t abi.Type, value interface{}) interface{} {
+	switch t.T {
+	case abi.IntTy, abi.UintTy:
+		return fmt.Sprint(value)
+	case abi.BytesTy:
+		return hexutil.Bytes(value.([]byte))
+	case abi.FixedBytesTy, abi.FunctionTy:
+		rv := reflect.ValueOf(value)
+		b := make([]byte, rv.Len())
+		reflect.Copy(reflect.ValueOf(b), rv)
+		return hexutil.Bytes(b)
+	case abi.SliceTy, abi.ArrayTy:
+		rv := reflect.ValueOf(value)
+		list := make([]interface{}, rv.Len())
+		for i := range list {
+			list[i] = toJSONValue(*t.Elem, rv.Index(i).Interface())
+		}
+		return list
+	case abi.TupleTy:
+		rv := reflect.ValueOf(value)
+		fields := make(map[string]interface{}, len(t.TupleElems))
+		for i, elem := range t.TupleElems {
+			fields[t.TupleRawNames[i]] = toJSONValue(*elem, rv.Field(i).Interface())
+		}
+		return fields
+	default:
+		return value
+	}
+}
+
+// decode interprets the revert payload against the standard Solidity error
+// selectors and the custom errors in contractABI.
+func (e *RevertError) decode(contractABI *abi.ABI) {
+	if len(e.Data) < 4 {
+		return
+	}
+	selector := e.Data[:4]
+
+	switch {
+	case bytes.Equal(selector, errorSelector):
+		if reason, err := abi.UnpackRevert(e.Data); err == nil {
+			e.Name = "Error"
+			e.Reason = reason
+		}
+
+	case bytes.Equal(selector, panicSelector) && len(e.Data) == 36:
+		code := new(big.Int).SetBytes(e.Data[4:])
+		e.Name = "Panic"
+		e.Args = map[string]interface{}{"code": code.String()}
+		if code.IsUint64() {
+			if reason, ok := panicReasons[code.Uint64()]; ok {
+				e.Reason = reason
+			}
+		}
+		if e.Reason == "" {
+			e.Reason = fmt.Sprintf("unknown panic code: 0x%x", code)
+		}
+
+	case contractABI != nil:
+		var id [4]byte
+		copy(id[:], selector)
+		customError, err := contractABI.ErrorByID(id)
+		if err != nil {
+			return
+		}
+		values, err := customError.Inputs.Unpack(e.Data[4:])
+		if err != nil {
+			return
+		}
+		e.Name = customError.Name
+		e.Args = make(map[string]interface{}, len(values))
+		for i, value := range values {
+			e.Args[customError.Inputs[i].Name] = toJSONValue(customError.Inputs[i].Type, value)
+		}
+	}
+}
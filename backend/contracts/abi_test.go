@@ -0,0 +1,69 @@
+package contracts
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+// TestParseIntegerRange checks integer arguments at both ends of the range of
+// their type, and just past them.
+func TestParseIntegerRange(t *testing.T) {
+	tests := []struct {
+		typ   string
+		value string
+		ok    bool
+	}{
+		{"uint8", "0", true},
+		{"uint8", "255", true},
+		{"uint8", "256", false},
+		{"uint8", "-1", false},
+		{"int8", "-128", true},
+		{"int8", "127", true},
+		{"int8", "-129", false},
+		{"int8", "128", false},
+		{"int64", "-9223372036854775808", true},
+		{"int64", "9223372036854775807", true},
+		{"int64", "-9223372036854775809", false},
+		{"int64", "9223372036854775808", false},
+		{"uint256", "115792089237316195423570985008687907853269984665640564039457584007913129639935", true},
+		{"uint256", "115792089237316195423570985008687907853269984665640564039457584007913129639936", false},
+		{"int256", "-57896044618658097711785492504343953926634992332820282019728792003956564819968", true},
+		{"int256", "57896044618658097711785492504343953926634992332820282019728792003956564819967", true},
+		{"int256", "-57896044618658097711785492504343953926634992332820282019728792003956564819969", false},
+		{"int256", "57896044618658097711785492504343953926634992332820282019728792003956564819968", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.typ+"/"+tt.value, func(t *testing.T) {
+			typ, err := abi.NewType(tt.typ, "", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			inputs := abi.Arguments{{Name: "x", Type: typ}}
+			args, err := ParseArgs(inputs, []string{tt.value})
+			if !tt.ok {
+				if err == nil {
+					t.Errorf("parsed as %v, want an error", args[0])
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsing failed: %v", err)
+			}
+
+			// The parsed value must pack, and pack to the value given
+			packed, err := inputs.Pack(args...)
+			if err != nil {
+				t.Fatalf("packing failed: %v", err)
+			}
+			unpacked, err := inputs.Unpack(packed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fmt.Sprint(unpacked[0]); got != tt.value {
+				t.Errorf("packed as %s, want %s", got, tt.value)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package contracts
+
+// jumpdestBitmap marks the positions in a contract's code that hold a JUMPDEST
+// opcode. Bytes that are immediate data of a PUSH instruction are never marked,
+// even if their value happens to be 0x5b.
+type jumpdestBitmap []byte
+
+// analyzeJumpdests scans code once before execution and records every valid
+// jump destination.
+func analyzeJumpdests(code []byte) jumpdestBitmap {
+	bitmap := make(jumpdestBitmap, len(code)/8+1)
+	for pc := 0; pc < len(code); pc++ {
+		op := code[pc]
+		switch {
+		case op == 0x5b: // JUMPDEST
+			bitmap[pc/8] |= 1 << (uint(pc) % 8)
+		case op >= 0x60 && op <= 0x7f: // PUSH1 ... PUSH32
+			pc += int(op - 0x5f)
+		}
+	}
+	return bitmap
+}
+
+// isJumpdest reports whether dest is a valid jump destination.
+func (b jumpdestBitmap) isJumpdest(dest uint64) bool {
+	if dest >= uint64(len(b))*8 {
+		return false
+	}
+	return b[dest/8]&(1<<(dest%8)) != 0
+}
@@ -0,0 +1,165 @@
+package contracts
+
+import (
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/holiman/uint256"
+)
+
+// maxCallDepth is the deepest a chain of nested calls may go. A call made at
+// this depth fails without running the callee.
+const maxCallDepth = 1024
+
+// callKind selects how a message call sets up the callee's frame.
+type callKind int
+
+const (
+	callKindCall         callKind = iota // CALL: run the callee's code against its own storage
+	callKindCallCode                     // CALLCODE: run the callee's code against the caller's storage
+	callKindDelegateCall                 // DELEGATECALL: as CALLCODE, keeping the caller's sender and value
+	callKindStaticCall                   // STATICCALL: as CALL, with state changes forbidden
+)
+
+// opCall implements CALL, CALLCODE, DELEGATECALL and STATICCALL. It charges the
+// call's gas, runs the callee in a nested frame and pushes 1 on success or 0 on
+// failure. Failures inside the callee roll back its state changes but do not
+// abort the calling frame.
+func (env *VMExecutionEnvironment) opCall(kind callKind) error {
+	requestedGas := env.pop()
+	target := env.popAddress()
+	value := new(uint256.Int)
+	if kind == callKindCall || kind == callKindCallCode {
+		v := env.pop()
+		value.Set(&v)
+	}
+	inOffset, inSize := env.pop(), env.pop()
+	retOffset, retSize := env.pop(), env.pop()
+
+	// Charge for the memory holding both the input and the output area
+	inOffset64, inSize64, err := env.expandMemory(&inOffset, &inSize)
+	if err != nil {
+		return err
+	}
+	retOffset64, retSize64, err := env.expandMemory(&retOffset, &retSize)
+	if err != nil {
+		return err
+	}
+
+	gas := env.accountAccessGas(target)
+	transfersValue := !value.IsZero()
+	if transfersValue {
+		if env.readOnly && kind == callKindCall {
+			return ErrWriteProtection
+		}
+		gas += gasCallValue
+		if kind == callKindCall && env.State.Empty(target) {
+			gas += gasCallNewAccount
+		}
+	}
+	if !env.useGas(gas) {
+		return ErrOutOfGas
+	}
+	calleeGas := env.callGas(&requestedGas)
+	env.Gas -= calleeGas
+	if env.Tracer != nil {
+		// The gas handed to the callee counts towards the cost of the step
+		env.traceStep(nil)
+	}
+	if transfersValue {
+		calleeGas += gasCallStipend
+	}
+
+	ctx := env.Context
+	switch kind {
+	case callKindCall, callKindStaticCall:
+		ctx.Caller = env.Context.Address
+		ctx.Address = target
+		ctx.Value = value
+	case callKindCallCode:
+		ctx.Caller = env.Context.Address
+		ctx.Value = value
+	case callKindDelegateCall:
+		// The callee sees the caller's own message unchanged
+	}
+
+	input := env.Memory.GetCopy(inOffset64, inSize64)
+	ret, gasLeft, err := env.runFrame(kind, ctx, target, input, calleeGas)
+	env.Gas += gasLeft
+
+	var revertErr *RevertError
+	if err == nil || errors.As(err, &revertErr) {
+		if retSize64 > uint64(len(ret)) {
+			retSize64 = uint64(len(ret))
+		}
+		env.Memory.Set(retOffset64, retSize64, ret)
+	}
+	env.returnData = ret
+	env.push(boolWord(err == nil))
+	return nil
+}
+
+// runFrame transfers the call's value and executes the code at target, or the
+// precompile at target, in a new frame one level below env, sharing env's world
+// state. The state changes of a failed
+// frame, value transfer included, are rolled back. A frame that reverts returns
+// its revert data and unused gas, any other failure consumes all of the frame's
+// gas.
+func (env *VMExecutionEnvironment) runFrame(kind callKind, ctx ExecutionContext, target common.Address, input []byte, gas uint64) (ret []byte, gasLeft uint64, err error) {
+	if env.depth+1 > maxCallDepth {
+		return nil, gas, ErrDepth
+	}
+	transfersValue := kind == callKindCall || kind == callKindCallCode
+	if transfersValue && !env.State.CanTransfer(env.Context.Address, ctx.Value) {
+		return nil, gas, ErrInsufficientBalance
+	}
+
+	snapshot := env.State.Snapshot()
+	if transfersValue {
+		// CALLCODE runs in the caller's own account, so its value stays put
+		env.State.Transfer(env.Context.Address, ctx.Address, ctx.Value)
+	}
+	if env.Tracer != nil {
+		value := ctx.Value
+		if kind == callKindStaticCall {
+			value = nil
+		}
+		env.Tracer.CaptureEnter(kind.String(), env.Context.Address, target, input, gas, value)
+		defer func() { env.Tracer.CaptureExit(ret, gas-gasLeft, err) }()
+	}
+	if p, ok := precompiles[target]; ok {
+		ret, gasLeft, err = runPrecompile(p, input, gas)
+		if err != nil {
+			env.State.RevertToSnapshot(snapshot)
+		}
+		return ret, gasLeft, err
+	}
+	code := env.State.GetCode(target)
+	if len(code) == 0 {
+		// Calls to accounts without code succeed without doing anything else
+		return nil, gas, nil
+	}
+
+	frame := &VMExecutionEnvironment{
+		Bytecode: code,
+		GasLimit: gas,
+		Gas:      gas,
+		Context:  ctx,
+		State:    env.State,
+		Tracer:   env.Tracer,
+		depth:    env.depth + 1,
+		readOnly: env.readOnly || kind == callKindStaticCall,
+	}
+	result, err := frame.ExecuteBytecode(code, input)
+	if err != nil {
+		env.State.RevertToSnapshot(snapshot)
+		var revertErr *RevertError
+		if errors.As(err, &revertErr) {
+			return revertErr.Data, frame.Gas, err
+		}
+		return nil, 0, err
+	}
+	ret, _ = result.([]byte)
+	return ret, frame.Gas, nil
+}
@@ -0,0 +1,111 @@
+package contracts
+
+import (
+	"errors"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/holiman/uint256"
+)
+
+// CallFrame is one call or creation in a CallTracer trace, in the JSON format
+// of geth's callTracer.
+type CallFrame struct {
+	Type         string          `json:"type"`
+	From         common.Address  `json:"from"`
+	Gas          hexutil.Uint64  `json:"gas"`
+	GasUsed      hexutil.Uint64  `json:"gasUsed"`
+	To           *common.Address `json:"to,omitempty"`
+	Input        hexutil.Bytes   `json:"input"`
+	Output       hexutil.Bytes   `json:"output,omitempty"`
+	Error        string          `json:"error,omitempty"`
+	RevertReason string          `json:"revertReason,omitempty"`
+	Calls        []*CallFrame    `json:"calls,omitempty"`
+	Value        *hexutil.Big    `json:"value,omitempty"`
+}
+
+// CallTracer is a Tracer that records the tree of calls and creations made by
+// a transaction, without the individual steps.
+type CallTracer struct {
+	gasLimit uint64
+	root     *CallFrame
+	stack    []*CallFrame // frames still running, innermost last
+}
+
+var _ Tracer = (*CallTracer)(nil)
+
+// NewCallTracer creates an empty CallTracer.
+func NewCallTracer() *CallTracer {
+	return &CallTracer{}
+}
+
+func (t *CallTracer) CaptureTxStart(gasLimit uint64) {
+	t.gasLimit = gasLimit
+}
+
+// CaptureTxEnd reports the gas of the whole transaction on the outermost
+// frame, as geth does.
+func (t *CallTracer) CaptureTxEnd(gasUsed uint64) {
+	if t.root != nil {
+		t.root.Gas = hexutil.Uint64(t.gasLimit)
+		t.root.GasUsed = hexutil.Uint64(gasUsed)
+	}
+}
+
+func (t *CallTracer) CaptureEnter(typ string, from, to common.Address, input []byte, gas uint64, value *uint256.Int) {
+	frame := &CallFrame{
+		Type:  typ,
+		From:  from,
+		To:    &to,
+		Input: common.CopyBytes(input),
+		Gas:   hexutil.Uint64(gas),
+	}
+	if value != nil {
+		frame.Value = (*hexutil.Big)(value.ToBig())
+	}
+	if len(t.stack) == 0 {
+		t.root = frame
+	} else {
+		parent := t.stack[len(t.stack)-1]
+		parent.Calls = append(parent.Calls, frame)
+	}
+	t.stack = append(t.stack, frame)
+}
+
+func (t *CallTracer) CaptureExit(output []byte, gasUsed uint64, err error) {
+	frame := t.stack[len(t.stack)-1]
+	t.stack = t.stack[:len(t.stack)-1]
+	frame.GasUsed = hexutil.Uint64(gasUsed)
+	frame.Output = common.CopyBytes(output)
+	if err == nil {
+		return
+	}
+
+	// Only a revert keeps its output, decoded when it is an Error(string)
+	var revertErr *RevertError
+	if errors.As(err, &revertErr) {
+		frame.Error = "execution reverted"
+		if reason, unpackErr := abi.UnpackRevert(output); unpackErr == nil {
+			frame.RevertReason = reason
+		}
+		return
+	}
+	frame.Error = err.Error()
+	frame.Output = nil
+	if frame.Type == "CREATE" || frame.Type == "CREATE2" {
+		frame.To = nil // Nothing was deployed
+	}
+}
+
+func (t *CallTracer) CaptureState(step *Step, err error) {}
+
+// StepConfig selects nothing, as the call tree is built from the frames alone.
+func (t *CallTracer) StepConfig() StepConfig {
+	return StepConfig{}
+}
+
+// Result returns the outermost frame of the trace, or nil if no code ran.
+func (t *CallTracer) Result() *CallFrame {
+	return t.root
+}
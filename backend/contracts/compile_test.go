@@ -0,0 +1,37 @@
+package contracts
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestCompileSoliditySourceSelectsContract compiles a source defining two
+// contracts through a stand-in for the compiler service.
+func TestCompileSoliditySourceSelectsContract(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{
+			"TenancyAgreement": {"abi": [], "evm": {"bytecode": {"object": "6001"}, "deployedBytecode": {}}},
+			"RentPayment": {"abi": [], "evm": {"bytecode": {"object": "6002", "sourceMap": "1:2:0"}, "deployedBytecode": {"sourceMap": "3:4:0"}}}
+		}`))
+	}))
+	defer server.Close()
+	defer func(url string) { CompilerURL = url }(CompilerURL)
+	CompilerURL = server.URL
+
+	compiled, err := CompileSoliditySource("contract TenancyAgreement {} contract RentPayment {}", "RentPayment")
+	if err != nil {
+		t.Fatalf("compilation failed: %v", err)
+	}
+	if compiled.Name != "RentPayment" || compiled.Bytecode != "6002" || compiled.SourceMap != "1:2:0" || compiled.DeployedSourceMap != "3:4:0" {
+		t.Errorf("compiled %+v, want RentPayment", compiled)
+	}
+
+	if _, err := CompileSoliditySource("", ""); err == nil || !strings.Contains(err.Error(), "RentPayment, TenancyAgreement") {
+		t.Errorf("unnamed contract of two: error %v, want the contracts listed", err)
+	}
+	if _, err := CompileSoliditySource("", "SecurityDeposit"); err == nil {
+		t.Error("missing contract: no error")
+	}
+}
@@ -0,0 +1,59 @@
+package contracts
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/uint256"
+)
+
+// ExecutionContext carries the transaction and block information that contract
+// code can observe through the environment opcodes (CALLER, CALLVALUE, NUMBER,
+// TIMESTAMP and so on). Unset numeric fields read as zero.
+type ExecutionContext struct {
+	// Message
+	Caller  common.Address // msg.sender
+	Origin  common.Address // tx.origin
+	Address common.Address // account whose code is running
+	Value   *uint256.Int   // msg.value in wei
+
+	// Transaction
+	GasPrice *uint256.Int
+
+	// Block
+	BlockNumber   uint64
+	Timestamp     uint64
+	Coinbase      common.Address
+	ChainID       *uint256.Int
+	BaseFee       *uint256.Int
+	Difficulty    *uint256.Int
+	BlockGasLimit uint64
+
+	// GetHash returns the hash of the block with the given number. BLOCKHASH
+	// only consults it for the 256 most recent blocks.
+	GetHash func(number uint64) common.Hash
+}
+
+// wordOrZero returns value, or zero when it has not been set.
+func wordOrZero(value *uint256.Int) *uint256.Int {
+	if value == nil {
+		return new(uint256.Int)
+	}
+	return new(uint256.Int).Set(value)
+}
+
+// addressWord converts an address into a stack word.
+func addressWord(address common.Address) *uint256.Int {
+	return new(uint256.Int).SetBytes20(address.Bytes())
+}
+
+// blockHash implements BLOCKHASH: only the 256 blocks before the current one are
+// available, anything else reads as zero.
+func (ctx *ExecutionContext) blockHash(number *uint256.Int) common.Hash {
+	num, overflow := number.Uint64WithOverflow()
+	if overflow || ctx.GetHash == nil || num >= ctx.BlockNumber {
+		return common.Hash{}
+	}
+	if ctx.BlockNumber > 256 && num < ctx.BlockNumber-256 {
+		return common.Hash{}
+	}
+	return ctx.GetHash(num)
+}
@@ -2,31 +2,58 @@ package contracts
 
 import (
 	"bytes"
-	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
-	"math/big"
+	"math"
 	"net/http"
 	"regexp"
 	"smartley-contracts/storage"
 	"smartley-contracts/types"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/holiman/uint256"
 	"golang.org/x/crypto/sha3"
 )
 
+// maxMemorySize bounds how far a single execution may expand its memory.
+const maxMemorySize = 32 * 1024 * 1024
+
 type VMExecutionEnvironment struct {
 	Stack          types.Stack
 	Memory         types.Memory
-	Storage        types.Storage
+	Storage        *types.Storage // Contract storage, used when State is nil
 	ProgramCounter int
 	Bytecode       []byte
 	ABI            []byte // Add this field
+	GasLimit       uint64 // Gas available to each call made through Execute
+	Gas            uint64 // Gas remaining in the current execution
+	GasUsed        uint64 // Gas consumed by the last call made through Execute
+	Context        ExecutionContext
+	State          *StateDB // World state, committed by Execute when the call succeeds
+	Tracer         Tracer   // Receives every step of execution when set
+
+	depth      int    // Call depth of this frame, 0 for the outermost call
+	readOnly   bool   // Set inside STATICCALL, where state changes are forbidden
+	returnData []byte // Output of the last sub-call made by this frame
+	logs       []*Log // Logs emitted by the last successful call
+	step       *Step  // Instruction being recorded for Tracer
+	simulate   bool   // Set by Simulate, which discards state changes instead of committing them
+}
+
+// ExecutionResult is the outcome of a call made through ExecuteWithArgs.
+type ExecutionResult struct {
+	ReturnValue interface{} `json:"result"`
+	GasUsed     uint64      `json:"gasUsed"`
+	Logs        []*Log      `json:"logs"`
 }
 
 // NewVMExecutionEnvironment creates a new VMExecutionEnvironment for the given contract.
@@ -47,61 +74,280 @@ func NewVMExecutionEnvironment(contract *Contract) *VMExecutionEnvironment {
 
 	abiBytes := []byte(contract.ABI)
 
+	storage := types.NewStorage()
+	storage.SetBytecode(bytecode)
+	storage.SetABI(abiBytes)
+
 	// Initialize the VMExecutionEnvironment with the appropriate values.
 	env := &VMExecutionEnvironment{
 		// Set the required fields based on the given contract.
+		Storage:  storage,
 		Bytecode: bytecode, // Use the decoded bytecode
 		ABI:      abiBytes, // Convert ABI to []byte
+		GasLimit: DefaultGasLimit,
 	}
 
 	return env
 }
 
-func (env *VMExecutionEnvironment) ExecuteWithArgs(functionSignature string, args []interface{}) (interface{}, error) {
+// ExecuteWithArgs calls a contract function by name. When the call runs but fails,
+// the returned result still reports the gas it used alongside the error.
+func (env *VMExecutionEnvironment) ExecuteWithArgs(functionSignature string, args []interface{}) (*ExecutionResult, error) {
 	// Parse the ABI from the environment
 	parsedABI, err := abi.JSON(bytes.NewReader(env.ABI))
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse ABI: %v", err)
 	}
 
-	// Encode the arguments according to the contract ABI
-	encodedArgs, err := parsedABI.Pack(functionSignature, args...)
+	method, ok := parsedABI.Methods[functionSignature]
+	if !ok {
+		return nil, fmt.Errorf("function not found in ABI: %s", functionSignature)
+	}
+
+	// Encode the arguments according to the contract ABI. Execute prepends the
+	// function selector, so only the arguments are packed here.
+	encodedArgs, err := method.Inputs.Pack(args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to encode arguments: %v", err)
 	}
 
-	// Call the Execute function with the prepared contract bytecode and encoded arguments
-	result, err := env.Execute(env.Bytecode, functionSignature, encodedArgs)
-	return result, err
-}
+	// Call the function with its selector followed by the encoded arguments
+	result, err := env.ExecuteInput(env.Bytecode, append(append([]byte{}, method.ID...), encodedArgs...))
+	if err != nil {
+		var revertErr *RevertError
+		if errors.As(err, &revertErr) {
+			revertErr.decode(&parsedABI)
+		}
+		return &ExecutionResult{GasUsed: env.GasUsed}, err
+	}
 
-func (env *VMExecutionEnvironment) Execute(contractBytecode []byte, functionSignature string, encodedArgs []byte) (interface{}, error) {
-	// Find the function selector
-	selector, err := findFunctionSelector(env.ABI, functionSignature)
+	// Decode the RETURN buffer into typed values using the method's outputs
+	returnData, _ := result.([]byte)
+	returnValue, err := decodeOutputs(method, returnData)
 	if err != nil {
 		return nil, err
 	}
+	return &ExecutionResult{ReturnValue: returnValue, GasUsed: env.GasUsed, Logs: env.Logs()}, nil
+}
+
+// Simulate calls a contract function like ExecuteWithArgs, as eth_call does:
+// the call runs against a copy-on-write view of the state and reports its
+// result, gas and logs, but every change it makes is discarded. The state,
+// and env.Storage when there is none, are left exactly as they were.
+func (env *VMExecutionEnvironment) Simulate(functionSignature string, args []interface{}) (*ExecutionResult, error) {
+	defer env.startSimulation()()
+	return env.ExecuteWithArgs(functionSignature, args)
+}
+
+// startSimulation makes the calls that follow discard their state changes, and
+// returns the function that ends the simulation and rolls the changes back.
+func (env *VMExecutionEnvironment) startSimulation() func() {
+	state := env.State
+	snapshot := 0
+	if state != nil {
+		snapshot = state.Snapshot()
+	}
+	env.simulate = true
+	return func() {
+		env.simulate = false
+		if state != nil {
+			state.RevertToSnapshot(snapshot)
+		}
+	}
+}
+
+// Logs returns the logs emitted by the last successful call made through Execute.
+func (env *VMExecutionEnvironment) Logs() []*Log {
+	return env.logs
+}
 
-	// Decode the function selector
-	selectorBytes, err := hex.DecodeString(selector)
+// Execute calls the function named functionSignature in the contract's ABI
+// with arguments already ABI-encoded, by prepending the function's selector.
+func (env *VMExecutionEnvironment) Execute(contractBytecode []byte, functionSignature string, encodedArgs []byte) (interface{}, error) {
+	parsedABI, err := abi.JSON(bytes.NewReader(env.ABI))
 	if err != nil {
-		return nil, fmt.Errorf("unable to decode selector: %v", err)
+		return nil, fmt.Errorf("failed to parse ABI: %v", err)
+	}
+	method, ok := parsedABI.Methods[functionSignature]
+	if !ok {
+		return nil, fmt.Errorf("function not found in ABI: %s", functionSignature)
 	}
 
 	// Concatenate the selector and encoded arguments
-	inputData := append(selectorBytes, encodedArgs...)
+	inputData := append(append([]byte{}, method.ID...), encodedArgs...)
+	return env.ExecuteInput(contractBytecode, inputData)
+}
 
-	fmt.Printf("Execute: inputData: %x\n", inputData)
+// ExecuteInput runs a call to env.Context.Address with raw calldata: it charges
+// the intrinsic gas, transfers env.Context.Value from the caller and runs
+// contractBytecode, if any. State changes are committed only if the call
+// succeeds.
+func (env *VMExecutionEnvironment) ExecuteInput(contractBytecode []byte, inputData []byte) (interface{}, error) {
+	// Charge the intrinsic cost of the call before any code runs
+	env.GasUsed = 0
+	intrinsic := intrinsicGas(inputData, false)
+	if env.GasLimit < intrinsic {
+		return nil, fmt.Errorf("%w: have %d, want %d", ErrIntrinsicGas, env.GasLimit, intrinsic)
+	}
+	env.Gas = env.GasLimit - intrinsic
+	env.Stack, env.Memory = nil, nil // Each call starts with a fresh frame
+	env.returnData = nil
+	env.logs = nil
+	if env.Tracer != nil {
+		env.Tracer.CaptureTxStart(env.GasLimit)
+		defer func() { env.Tracer.CaptureTxEnd(env.GasUsed) }()
+	}
 
-	// Execute the contract bytecode with the given input data
-	returnValue, err := env.ExecuteBytecode(contractBytecode, inputData)
+	// Without a world state the contract's own storage is the only account,
+	// so the caller has no balance to send value from. Either way execution
+	// writes to working copies, so that a failed call is discarded and only a
+	// successful call is committed.
+	value := wordOrZero(env.Context.Value)
+	if env.State == nil {
+		accounts := make(map[common.Address]*types.Storage)
+		if env.Storage != nil {
+			accounts[env.Context.Address] = env.Storage
+		}
+		env.State = NewStateDB(accounts)
+		defer func() {
+			env.Storage = accounts[env.Context.Address]
+			env.State = nil
+		}()
+	}
+	state := env.State
+
+	if !state.CanTransfer(env.Context.Caller, value) {
+		return nil, fmt.Errorf("%w: address %s has %s, want %s", ErrInsufficientBalance, env.Context.Caller.Hex(), state.GetBalance(env.Context.Caller).Dec(), value.Dec())
+	}
+	state.Transfer(env.Context.Caller, env.Context.Address, value)
+
+	env.prepareAccessList()
+
+	// Execute the contract bytecode with the given input data. Accounts
+	// without code simply receive the value.
+	if env.Tracer != nil {
+		env.Tracer.CaptureEnter("CALL", env.Context.Caller, env.Context.Address, inputData, env.Gas, value)
+	}
+	startGas := env.Gas
+	var returnValue interface{}
+	var err error
+	if len(contractBytecode) > 0 {
+		returnValue, err = env.ExecuteBytecode(contractBytecode, inputData)
+	}
+
+	var revertErr *RevertError
+	if env.Tracer != nil {
+		output, _ := returnValue.([]byte)
+		gasUsed := startGas - env.Gas
+		if errors.As(err, &revertErr) {
+			output = revertErr.Data
+		} else if err != nil {
+			gasUsed = startGas
+		}
+		env.Tracer.CaptureExit(output, gasUsed, err)
+	}
+	switch {
+	case err == nil:
+		refund := state.GetRefund()
+		if maxRefund := (env.GasLimit - env.Gas) / maxRefundQuotient; refund > maxRefund {
+			refund = maxRefund
+		}
+		env.Gas += refund
+		env.logs = state.Logs()
+		env.decodeLogs()
+		if !env.simulate {
+			state.Commit()
+		}
+	case errors.As(err, &revertErr):
+		// REVERT hands the remaining gas back to the caller
+	default:
+		// Every other failure, out of gas included, consumes all gas
+		env.Gas = 0
+	}
+	env.GasUsed = env.GasLimit - env.Gas
 	return returnValue, err
 }
 
-func (env *VMExecutionEnvironment) ExecuteBytecode(contractBytecode []byte, inputData []byte) (interface{}, error) {
-	pc := 0
+// prepareAccessList marks the accounts that are warm from the start of a
+// transaction (EIP-2929): the sender, the called or created contract and the
+// precompiles.
+func (env *VMExecutionEnvironment) prepareAccessList() {
+	env.State.AddAddressToAccessList(env.Context.Origin)
+	env.State.AddAddressToAccessList(env.Context.Caller)
+	env.State.AddAddressToAccessList(env.Context.Address)
+	for address := range precompiles {
+		env.State.AddAddressToAccessList(address)
+	}
+}
+
+// decodeLogs names the fields of the logs emitted by the last call, using the
+// ABI of each emitting contract. Logs whose contract has no usable ABI are left
+// undecoded.
+func (env *VMExecutionEnvironment) decodeLogs() {
+	parsedABIs := make(map[common.Address]*abi.ABI)
+	for _, l := range env.logs {
+		contractABI, ok := parsedABIs[l.Address]
+		if !ok {
+			abiJSON := env.ABI
+			if l.Address != env.Context.Address {
+				abiJSON = nil
+				if storage := env.State.GetStorage(l.Address); storage != nil {
+					abiJSON = storage.GetABI()
+				}
+			}
+			if parsed, err := abi.JSON(bytes.NewReader(abiJSON)); err == nil {
+				contractABI = &parsed
+			}
+			parsedABIs[l.Address] = contractABI
+		}
+		if contractABI == nil {
+			continue
+		}
+		if err := l.Decode(contractABI); err != nil {
+			log.Printf("Failed to decode log from %s: %v", l.Address.Hex(), err)
+		}
+	}
+}
+
+func (env *VMExecutionEnvironment) ExecuteBytecode(contractBytecode []byte, inputData []byte) (result interface{}, err error) {
+	jumpdests := analyzeJumpdests(contractBytecode)
+	pc, start := 0, 0
+	defer func() {
+		if err != nil {
+			err = &ExecutionError{Address: env.Context.Address, PC: uint64(start), Err: err}
+		}
+	}()
+	if env.Tracer != nil {
+		// Report the instruction that ended the frame, and why it failed
+		defer func() {
+			var revertErr *RevertError
+			if errors.As(err, &revertErr) {
+				env.traceStep(nil)
+			} else {
+				env.traceStep(err)
+			}
+		}()
+	}
+
 	for pc < len(contractBytecode) {
+		start = pc
 		opCode := contractBytecode[pc]
+		if env.Tracer != nil {
+			env.captureStep(pc, opCode)
+		}
+		info := operations[opCode]
+		if info == nil {
+			return nil, fmt.Errorf("unknown opcode: 0x%x", opCode)
+		}
+		if env.Stack.Len() < info.pops {
+			return nil, fmt.Errorf("%w: %s at pc %d requires %d stack items, have %d", types.ErrStackUnderflow, info.name, pc, info.pops, env.Stack.Len())
+		}
+		if env.Stack.Len()-info.pops+info.pushes > types.StackLimit {
+			return nil, fmt.Errorf("%w: %s at pc %d exceeds the limit of %d stack items", types.ErrStackOverflow, info.name, pc, types.StackLimit)
+		}
+		if !env.useGas(info.gas) {
+			return nil, ErrOutOfGas
+		}
 		pc++
 		switch opCode {
 
@@ -109,99 +355,559 @@ func (env *VMExecutionEnvironment) ExecuteBytecode(contractBytecode []byte, inpu
 			return nil, nil
 
 		case 0x01: // ADD
-			x, y := env.Stack.Pop(), env.Stack.Pop()
-			env.Stack.Push(x + y)
+			x, y := env.pop(), env.pop()
+			env.push(x.Add(&x, &y))
 
 		case 0x02: // MUL
-			x, y := env.Stack.Pop(), env.Stack.Pop()
-			env.Stack.Push(x * y)
+			x, y := env.pop(), env.pop()
+			env.push(x.Mul(&x, &y))
 
-		// ... implement other arithmetic and logical opcodes ...
+		case 0x03: // SUB
+			x, y := env.pop(), env.pop()
+			env.push(x.Sub(&x, &y))
 
-		case 0x35: // CALLDATALOAD
-			index := env.Stack.Pop()
-			indexInt := int(index)
-			if err := checkSliceBounds(inputData, indexInt, indexInt+32); err != nil {
+		case 0x04: // DIV
+			x, y := env.pop(), env.pop()
+			env.push(x.Div(&x, &y))
+
+		case 0x05: // SDIV
+			x, y := env.pop(), env.pop()
+			env.push(x.SDiv(&x, &y))
+
+		case 0x06: // MOD
+			x, y := env.pop(), env.pop()
+			env.push(x.Mod(&x, &y))
+
+		case 0x07: // SMOD
+			x, y := env.pop(), env.pop()
+			env.push(x.SMod(&x, &y))
+
+		case 0x08: // ADDMOD
+			x, y, m := env.pop(), env.pop(), env.pop()
+			env.push(x.AddMod(&x, &y, &m))
+
+		case 0x09: // MULMOD
+			x, y, m := env.pop(), env.pop(), env.pop()
+			env.push(x.MulMod(&x, &y, &m))
+
+		case 0x0a: // EXP
+			base, exponent := env.pop(), env.pop()
+			if !env.useGas(gasExpByte * uint64(exponent.ByteLen())) {
+				return nil, ErrOutOfGas
+			}
+			env.push(base.Exp(&base, &exponent))
+
+		case 0x0b: // SIGNEXTEND
+			back, num := env.pop(), env.pop()
+			env.push(num.ExtendSign(&num, &back))
+
+		case 0x10: // LT
+			x, y := env.pop(), env.pop()
+			env.push(boolWord(x.Lt(&y)))
+
+		case 0x11: // GT
+			x, y := env.pop(), env.pop()
+			env.push(boolWord(x.Gt(&y)))
+
+		case 0x12: // SLT
+			x, y := env.pop(), env.pop()
+			env.push(boolWord(x.Slt(&y)))
+
+		case 0x13: // SGT
+			x, y := env.pop(), env.pop()
+			env.push(boolWord(x.Sgt(&y)))
+
+		case 0x14: // EQ
+			x, y := env.pop(), env.pop()
+			env.push(boolWord(x.Eq(&y)))
+
+		case 0x15: // ISZERO
+			x := env.pop()
+			env.push(boolWord(x.IsZero()))
+
+		case 0x16: // AND
+			x, y := env.pop(), env.pop()
+			env.push(x.And(&x, &y))
+
+		case 0x17: // OR
+			x, y := env.pop(), env.pop()
+			env.push(x.Or(&x, &y))
+
+		case 0x18: // XOR
+			x, y := env.pop(), env.pop()
+			env.push(x.Xor(&x, &y))
+
+		case 0x19: // NOT
+			x := env.pop()
+			env.push(x.Not(&x))
+
+		case 0x1a: // BYTE
+			th, val := env.pop(), env.pop()
+			env.push(val.Byte(&th))
+
+		case 0x1b: // SHL
+			shift, value := env.pop(), env.pop()
+			if shift.LtUint64(256) {
+				value.Lsh(&value, uint(shift.Uint64()))
+			} else {
+				value.Clear()
+			}
+			env.push(&value)
+
+		case 0x1c: // SHR
+			shift, value := env.pop(), env.pop()
+			if shift.LtUint64(256) {
+				value.Rsh(&value, uint(shift.Uint64()))
+			} else {
+				value.Clear()
+			}
+			env.push(&value)
+
+		case 0x1d: // SAR
+			shift, value := env.pop(), env.pop()
+			switch {
+			case shift.LtUint64(256):
+				value.SRsh(&value, uint(shift.Uint64()))
+			case value.Sign() >= 0:
+				value.Clear()
+			default:
+				// Shifting a negative value by 256 or more fills every bit with the sign.
+				value.SetAllOne()
+			}
+			env.push(&value)
+
+		case 0x20: // KECCAK256
+			offset, size := env.pop(), env.pop()
+			offset64, size64, err := env.expandMemory(&offset, &size)
+			if err != nil {
 				return nil, err
 			}
-			data := big.NewInt(0).SetBytes(inputData[indexInt : indexInt+32])
-			env.Stack.Push(data.Int64())
+			if !env.useGas(gasKeccak256Word * toWordSize(size64)) {
+				return nil, ErrOutOfGas
+			}
+			hasher := sha3.NewLegacyKeccak256()
+			hasher.Write(env.Memory.GetCopy(offset64, size64))
+			env.push(new(uint256.Int).SetBytes(hasher.Sum(nil)))
+
+		case 0x30: // ADDRESS
+			env.push(addressWord(env.Context.Address))
+
+		case 0x31: // BALANCE
+			address := env.popAddress()
+			if !env.useGas(env.accountAccessGas(address)) {
+				return nil, ErrOutOfGas
+			}
+			env.push(env.State.GetBalance(address))
+
+		case 0x32: // ORIGIN
+			env.push(addressWord(env.Context.Origin))
+
+		case 0x33: // CALLER
+			env.push(addressWord(env.Context.Caller))
+
+		case 0x34: // CALLVALUE
+			env.push(wordOrZero(env.Context.Value))
+
+		case 0x35: // CALLDATALOAD
+			index := env.pop()
+			var data uint256.Int
+			if offset, overflow := index.Uint64WithOverflow(); !overflow {
+				data.SetBytes(getData(inputData, offset, 32))
+			}
+			env.push(&data)
 
 		case 0x36: // CALLDATASIZE
-			env.Stack.Push(int64(len(inputData)))
+			env.push(uint256.NewInt(uint64(len(inputData))))
 
 		case 0x37: // CALLDATACOPY
-			memOffset := env.Stack.Pop()
-			dataOffset := env.Stack.Pop()
-			length := env.Stack.Pop()
+			memOffset := env.pop()
+			dataOffset := env.pop()
+			length := env.pop()
+
+			memOffset64, length64, err := env.expandMemory(&memOffset, &length)
+			if err != nil {
+				return nil, err
+			}
+			if !env.useGas(gasCopyWord * toWordSize(length64)) {
+				return nil, ErrOutOfGas
+			}
+			dataOffset64, overflow := dataOffset.Uint64WithOverflow()
+			if overflow {
+				dataOffset64 = math.MaxUint64
+			}
+			env.Memory.Set(memOffset64, length64, getData(inputData, dataOffset64, length64))
 
-			memOffsetInt := int(memOffset)
-			dataOffsetInt := int(dataOffset)
-			lengthInt := int(length)
+		case 0x38: // CODESIZE
+			env.push(uint256.NewInt(uint64(len(contractBytecode))))
 
-			if err := checkSliceBounds(env.Memory, memOffsetInt, memOffsetInt+lengthInt); err != nil {
+		case 0x39: // CODECOPY
+			memOffset, codeOffset, length := env.pop(), env.pop(), env.pop()
+			memOffset64, length64, err := env.expandMemory(&memOffset, &length)
+			if err != nil {
 				return nil, err
 			}
-			if err := checkSliceBounds(inputData, dataOffsetInt, dataOffsetInt+lengthInt); err != nil {
-				return nil, fmt.Errorf("error in CALLDATACOPY: %w, dataOffset: %d, length: %d, inputData length: %d", err, dataOffsetInt, lengthInt, len(inputData))
+			if !env.useGas(gasCopyWord * toWordSize(length64)) {
+				return nil, ErrOutOfGas
+			}
+			codeOffset64, overflow := codeOffset.Uint64WithOverflow()
+			if overflow {
+				codeOffset64 = math.MaxUint64
+			}
+			env.Memory.Set(memOffset64, length64, getData(contractBytecode, codeOffset64, length64))
+
+		case 0x3a: // GASPRICE
+			env.push(wordOrZero(env.Context.GasPrice))
+
+		case 0x3b: // EXTCODESIZE
+			address := env.popAddress()
+			if !env.useGas(env.accountAccessGas(address)) {
+				return nil, ErrOutOfGas
+			}
+			env.push(uint256.NewInt(uint64(len(env.State.GetCode(address)))))
+
+		case 0x3c: // EXTCODECOPY
+			address := env.popAddress()
+			memOffset, codeOffset, length := env.pop(), env.pop(), env.pop()
+			memOffset64, length64, err := env.expandMemory(&memOffset, &length)
+			if err != nil {
+				return nil, err
+			}
+			if !env.useGas(gasCopyWord*toWordSize(length64) + env.accountAccessGas(address)) {
+				return nil, ErrOutOfGas
+			}
+			codeOffset64, overflow := codeOffset.Uint64WithOverflow()
+			if overflow {
+				codeOffset64 = math.MaxUint64
+			}
+			env.Memory.Set(memOffset64, length64, getData(env.State.GetCode(address), codeOffset64, length64))
+
+		case 0x3d: // RETURNDATASIZE
+			env.push(uint256.NewInt(uint64(len(env.returnData))))
+
+		case 0x3e: // RETURNDATACOPY
+			memOffset, dataOffset, length := env.pop(), env.pop(), env.pop()
+			dataOffset64, overflow := dataOffset.Uint64WithOverflow()
+			end := dataOffset64 + length.Uint64()
+			if overflow || !length.IsUint64() || end < dataOffset64 || end > uint64(len(env.returnData)) {
+				return nil, ErrReturnDataOutOfBounds
+			}
+			memOffset64, length64, err := env.expandMemory(&memOffset, &length)
+			if err != nil {
+				return nil, err
+			}
+			if !env.useGas(gasCopyWord * toWordSize(length64)) {
+				return nil, ErrOutOfGas
+			}
+			env.Memory.Set(memOffset64, length64, env.returnData[dataOffset64:end])
+
+		case 0x3f: // EXTCODEHASH
+			address := env.popAddress()
+			if !env.useGas(env.accountAccessGas(address)) {
+				return nil, ErrOutOfGas
+			}
+			if env.State.Empty(address) {
+				env.push(new(uint256.Int))
+				break
 			}
-			copy(env.Memory[memOffsetInt:memOffsetInt+lengthInt], inputData[dataOffsetInt:dataOffsetInt+lengthInt])
+			hash := crypto.Keccak256Hash(env.State.GetCode(address))
+			env.push(new(uint256.Int).SetBytes32(hash[:]))
+
+		case 0x40: // BLOCKHASH
+			number := env.pop()
+			hash := env.Context.blockHash(&number)
+			env.push(new(uint256.Int).SetBytes32(hash[:]))
+
+		case 0x41: // COINBASE
+			env.push(addressWord(env.Context.Coinbase))
+
+		case 0x42: // TIMESTAMP
+			env.push(uint256.NewInt(env.Context.Timestamp))
+
+		case 0x43: // NUMBER
+			env.push(uint256.NewInt(env.Context.BlockNumber))
+
+		case 0x44: // DIFFICULTY
+			env.push(wordOrZero(env.Context.Difficulty))
+
+		case 0x45: // GASLIMIT
+			env.push(uint256.NewInt(env.Context.BlockGasLimit))
+
+		case 0x46: // CHAINID
+			env.push(wordOrZero(env.Context.ChainID))
+
+		case 0x47: // SELFBALANCE
+			env.push(env.State.GetBalance(env.Context.Address))
+
+		case 0x48: // BASEFEE
+			env.push(wordOrZero(env.Context.BaseFee))
+
+		case 0x50: // POP
+			env.pop()
 
 		case 0x51: // MLOAD
-			offset := env.Stack.Pop()
-			if err := checkSliceBounds(env.Memory, int(offset), int(offset+32)); err != nil {
+			offset := env.pop()
+			offset64, _, err := env.expandMemory(&offset, uint256.NewInt(32))
+			if err != nil {
 				return nil, err
 			}
-			value := big.NewInt(0).SetBytes(env.Memory[offset : offset+32])
-			env.Stack.Push(value.Int64())
+			var value uint256.Int
+			value.SetBytes32(env.Memory[offset64 : offset64+32])
+			env.push(&value)
 
 		case 0x52: // MSTORE
-			offset, value := env.Stack.Pop(), env.Stack.Pop()
-			if err := checkSliceBounds(env.Memory, int(offset), int(offset+32)); err != nil {
+			offset, value := env.pop(), env.pop()
+			offset64, _, err := env.expandMemory(&offset, uint256.NewInt(32))
+			if err != nil {
+				return nil, err
+			}
+			env.Memory.Set32(offset64, &value)
+
+		case 0x53: // MSTORE8
+			offset, value := env.pop(), env.pop()
+			offset64, _, err := env.expandMemory(&offset, uint256.NewInt(1))
+			if err != nil {
+				return nil, err
+			}
+			env.Memory[offset64] = byte(value.Uint64())
+
+		case 0x54: // SLOAD
+			key := env.pop()
+			if !env.useGas(env.sloadGas(key.Bytes32())) {
+				return nil, ErrOutOfGas
+			}
+			value := env.State.GetState(env.Context.Address, key.Bytes32())
+			env.push(new(uint256.Int).SetBytes32(value[:]))
+			if env.step != nil {
+				env.step.Storage = &StorageDiff{Key: key.Bytes32(), Prev: value, Value: value}
+			}
+
+		case 0x55: // SSTORE
+			if env.readOnly {
+				return nil, ErrWriteProtection
+			}
+			if env.Gas <= gasSstoreSentry {
+				return nil, ErrOutOfGas
+			}
+			key, value := env.pop(), env.pop()
+			if !env.useGas(env.sstoreGas(key.Bytes32(), value.Bytes32())) {
+				return nil, ErrOutOfGas
+			}
+			if env.step != nil {
+				env.step.Storage = &StorageDiff{Key: key.Bytes32(), Prev: env.State.GetState(env.Context.Address, key.Bytes32()), Value: value.Bytes32()}
+			}
+			env.State.SetState(env.Context.Address, key.Bytes32(), value.Bytes32())
+
+		case 0x56: // JUMP
+			dest := env.pop()
+			if !validJump(jumpdests, &dest) {
+				return nil, &InvalidJumpError{PC: pc - 1, Destination: dest}
+			}
+			pc = int(dest.Uint64())
+
+		case 0x57: // JUMPI
+			dest, cond := env.pop(), env.pop()
+			if !cond.IsZero() {
+				if !validJump(jumpdests, &dest) {
+					return nil, &InvalidJumpError{PC: pc - 1, Destination: dest}
+				}
+				pc = int(dest.Uint64())
+			}
+
+		case 0x58: // PC
+			env.push(uint256.NewInt(uint64(pc - 1)))
+
+		case 0x59: // MSIZE
+			env.push(uint256.NewInt(uint64(len(env.Memory))))
+
+		case 0x5a: // GAS
+			env.push(uint256.NewInt(env.Gas))
+
+		case 0x5b: // JUMPDEST
+
+		case 0x5f: // PUSH0
+			env.push(new(uint256.Int))
+
+		case 0x60, 0x61, 0x62, 0x63, 0x64, 0x65, 0x66, 0x67,
+			0x68, 0x69, 0x6a, 0x6b, 0x6c, 0x6d, 0x6e, 0x6f,
+			0x70, 0x71, 0x72, 0x73, 0x74, 0x75, 0x76, 0x77,
+			0x78, 0x79, 0x7a, 0x7b, 0x7c, 0x7d, 0x7e, 0x7f: // PUSH1 ... PUSH32
+			size := uint64(opCode - 0x5f)
+			var value uint256.Int
+			value.SetBytes(getData(contractBytecode, uint64(pc), size))
+			env.push(&value)
+			pc += int(size)
+
+		case 0x80, 0x81, 0x82, 0x83, 0x84, 0x85, 0x86, 0x87,
+			0x88, 0x89, 0x8a, 0x8b, 0x8c, 0x8d, 0x8e, 0x8f: // DUP1 ... DUP16
+			if err := env.Stack.Dup(int(opCode - 0x7f)); err != nil {
 				return nil, err
 			}
-			binary.BigEndian.PutUint64(env.Memory[offset:offset+32], uint64(value))
 
-		// ... implement other memory and storage opcodes ...
+		case 0x90, 0x91, 0x92, 0x93, 0x94, 0x95, 0x96, 0x97,
+			0x98, 0x99, 0x9a, 0x9b, 0x9c, 0x9d, 0x9e, 0x9f: // SWAP1 ... SWAP16
+			if err := env.Stack.Swap(int(opCode - 0x8f)); err != nil {
+				return nil, err
+			}
 
-		case 0x60: // PUSH1
-			if err := checkSliceBounds(contractBytecode, pc, pc+1); err != nil {
+		case 0xa0, 0xa1, 0xa2, 0xa3, 0xa4: // LOG0 ... LOG4
+			if env.readOnly {
+				return nil, ErrWriteProtection
+			}
+			offset, size := env.pop(), env.pop()
+			topics := make([]common.Hash, opCode-0xa0)
+			for i := range topics {
+				topic := env.pop()
+				topics[i] = topic.Bytes32()
+			}
+			offset64, size64, err := env.expandMemory(&offset, &size)
+			if err != nil {
+				return nil, err
+			}
+			if !env.useGas(gasLogData * size64) {
+				return nil, ErrOutOfGas
+			}
+			env.State.AddLog(&Log{
+				Address: env.Context.Address,
+				Topics:  topics,
+				Data:    env.Memory.GetCopy(offset64, size64),
+			})
+
+		case 0xf0: // CREATE
+			if err := env.opCreate(false); err != nil {
 				return nil, err
 			}
-			value := int64(contractBytecode[pc])
-			env.Stack.Push(value)
-			pc++
 
-		// ... implement other push opcodes ...
+		case 0xf1: // CALL
+			if err := env.opCall(callKindCall); err != nil {
+				return nil, err
+			}
 
-		case 0x80: // DUP1
-			value := env.Stack.Peek(0)
-			env.Stack.Push(value)
+		case 0xf2: // CALLCODE
+			if err := env.opCall(callKindCallCode); err != nil {
+				return nil, err
+			}
 
-		// ... implement other dup opcodes ...
+		case 0xf3: // RETURN
+			offset, size := env.pop(), env.pop()
+			offset64, size64, err := env.expandMemory(&offset, &size)
+			if err != nil {
+				return nil, err
+			}
+			return env.Memory.GetCopy(offset64, size64), nil
+
+		case 0xf4: // DELEGATECALL
+			if err := env.opCall(callKindDelegateCall); err != nil {
+				return nil, err
+			}
+
+		case 0xf5: // CREATE2
+			if err := env.opCreate(true); err != nil {
+				return nil, err
+			}
 
-		case 0x90: // SWAP1
-			x, y := env.Stack.Pop(), env.Stack.Pop()
-			env.Stack.Push(x)
-			env.Stack.Push(y)
+		case 0xfa: // STATICCALL
+			if err := env.opCall(callKindStaticCall); err != nil {
+				return nil, err
+			}
 
-		// ... implement other swap opcodes ...
+		case 0xfd: // REVERT
+			offset, size := env.pop(), env.pop()
+			offset64, size64, err := env.expandMemory(&offset, &size)
+			if err != nil {
+				return nil, err
+			}
+			return nil, &RevertError{Data: env.Memory.GetCopy(offset64, size64)}
 
-		// ... implement other opcodes ...
+		case 0xfe: // INVALID
+			return nil, fmt.Errorf("invalid opcode: INVALID at pc %d", pc-1)
 
 		default:
 			return nil, fmt.Errorf("unknown opcode: 0x%x", opCode)
 		}
+		if env.Tracer != nil {
+			env.traceStep(nil)
+		}
 	}
 
-	return nil, fmt.Errorf("execution reached end of bytecode without encountering STOP or RETURN")
+	// Running past the end of the code is an implicit STOP
+	return nil, nil
 }
 
-func checkSliceBounds(slice []byte, start int, end int) error {
-	if start < 0 || start >= len(slice) || end < 0 || end > len(slice) {
-		return fmt.Errorf("slice bounds out of range [%d:%d] with length %d", start, end, len(slice))
+// expandMemory charges for and grows memory so that the range [offset, offset+size)
+// is addressable, and returns the range as native integers. A zero size never
+// expands memory.
+func (env *VMExecutionEnvironment) expandMemory(offset, size *uint256.Int) (uint64, uint64, error) {
+	if size.IsZero() {
+		return 0, 0, nil
+	}
+	// Ranges beyond maxMemorySize would cost more gas than any call can carry.
+	offset64, overflow := offset.Uint64WithOverflow()
+	if overflow {
+		return 0, 0, ErrOutOfGas
+	}
+	size64, overflow := size.Uint64WithOverflow()
+	if overflow || offset64+size64 < offset64 || offset64+size64 > maxMemorySize {
+		return 0, 0, ErrOutOfGas
+	}
+
+	// Memory is always expanded in whole 32-byte words.
+	newSize := toWordSize(offset64+size64) * 32
+	if oldSize := uint64(len(env.Memory)); newSize > oldSize {
+		if !env.useGas(memoryGasCost(newSize) - memoryGasCost(oldSize)) {
+			return 0, 0, ErrOutOfGas
+		}
+		env.Memory.Resize(newSize)
 	}
-	return nil
+	return offset64, size64, nil
+}
+
+// pop removes the top stack word. Stack depth is checked against the operation
+// table before every instruction, so the underflow error cannot occur here.
+func (env *VMExecutionEnvironment) pop() uint256.Int {
+	value, _ := env.Stack.Pop()
+	return value
+}
+
+// popAddress removes the top stack word and returns its low 20 bytes as an address.
+func (env *VMExecutionEnvironment) popAddress() common.Address {
+	value := env.pop()
+	return common.Address(value.Bytes20())
+}
+
+// push adds value to the top of the stack. As with pop, the stack limit has
+// already been checked for the current instruction.
+func (env *VMExecutionEnvironment) push(value *uint256.Int) {
+	_ = env.Stack.Push(value)
+}
+
+// validJump reports whether dest points at a JUMPDEST in the analysed code.
+func validJump(jumpdests jumpdestBitmap, dest *uint256.Int) bool {
+	dest64, overflow := dest.Uint64WithOverflow()
+	return !overflow && jumpdests.isJumpdest(dest64)
+}
+
+// boolWord converts a comparison result into the EVM's 0/1 word representation.
+func boolWord(b bool) *uint256.Int {
+	if b {
+		return uint256.NewInt(1)
+	}
+	return new(uint256.Int)
+}
+
+// getData returns size bytes of data starting at start, right-padded with
+// zeroes where the range runs past the end of data.
+func getData(data []byte, start uint64, size uint64) []byte {
+	length := uint64(len(data))
+	if start > length {
+		start = length
+	}
+	end := start + size
+	if end > length || end < start {
+		end = length
+	}
+	padded := make([]byte, size)
+	copy(padded, data[start:end])
+	return padded
 }
 
 // Add other functions and types in the contracts package here
@@ -216,42 +922,10 @@ type Contract struct {
 	Name              string    `json:"name"`
 	Source            string    `json:"source"`
 	Bytecode          string    `json:"bytecode"`
+	ConstructorArgs   []string  `json:"constructorArgs,omitempty"` // Passed to the constructor at deployment
 	RicardianContract string    `json:"ricardianContract,omitempty"`
-}
-
-// findFunctionSelector finds the function selector for a given function signature in the ABI.
-func findFunctionSelector(abiBytes []byte, functionSignature string) (string, error) {
-	var abi []map[string]interface{}
-	err := json.Unmarshal(abiBytes, &abi)
-	if err != nil {
-		return "", fmt.Errorf("failed to unmarshal ABI: %v", err)
-	}
-
-	functionFound := false
-	var selector string
-	for _, item := range abi {
-		if item["type"].(string) == "function" && item["name"].(string) == functionSignature {
-			functionFound = true
-			inputs := item["inputs"].([]interface{})
-			signature := functionSignature + "("
-			for i, input := range inputs {
-				inputMap := input.(map[string]interface{})
-				signature += inputMap["type"].(string)
-				if i < len(inputs)-1 {
-					signature += ","
-				}
-			}
-			signature += ")"
-			selector = Keccak256(signature)[:8]
-			break
-		}
-	}
-
-	if !functionFound {
-		return "", fmt.Errorf("function not found in ABI: %s", functionSignature)
-	}
-
-	return selector, nil
+	SourceMap         string    `json:"source_map,omitempty"`          // solc source map of Bytecode
+	DeployedSourceMap string    `json:"deployed_source_map,omitempty"` // solc source map of the runtime code
 }
 
 // Keccak256 returns a keccak256 hash of the given string.
@@ -273,24 +947,39 @@ func GetContract(id string) (*Contract, error) {
 	return &contract, err
 }
 
+// CompilerURL is the endpoint of the compiler service.
+var CompilerURL = "http://localhost:4000/compile"
+
+// SourceName is the file name the compiler service compiles a source under.
+const SourceName = "contract.sol"
+
+// CompiledContract is a contract compiled by the compiler service. The source
+// maps cover the creation and runtime code respectively.
 type CompiledContract struct {
-	ABI      interface{} `json:"abi"`
-	Bytecode string      `json:"bytecode"`
+	Name              string          `json:"name"`
+	ABI               json.RawMessage `json:"abi"`
+	Bytecode          string          `json:"bytecode"`
+	SourceMap         string          `json:"sourceMap"`
+	DeployedSourceMap string          `json:"deployedSourceMap"`
 }
 
-func CompileSoliditySource(soliditySource string) ([]byte, string, error) {
-	apiUrl := "http://localhost:4000/compile"
+// CompileSoliditySource compiles a contract through the compiler service.
+// contractName selects the contract to return from a source that defines
+// several, such as a contract together with the contracts it calls; it may be
+// empty if the source defines only one.
+func CompileSoliditySource(soliditySource, contractName string) (*CompiledContract, error) {
+	apiUrl := CompilerURL
 
 	reqBody, err := json.Marshal(map[string]string{
 		"source": soliditySource,
 	})
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
 	resp, err := http.Post(apiUrl, "application/json", bytes.NewBuffer(reqBody))
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
@@ -298,64 +987,90 @@ func CompileSoliditySource(soliditySource string) ([]byte, string, error) {
 	fmt.Println("Response JSON:")
 	fmt.Println(string(respBody))
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
 	if resp.StatusCode != http.StatusOK {
 		var errorResp map[string]string
 		json.Unmarshal(respBody, &errorResp)
-		return nil, "", errors.New(errorResp["error"])
+		return nil, errors.New(errorResp["error"])
 	}
 
 	var compiledOutput map[string]map[string]interface{}
 	err = json.Unmarshal(respBody, &compiledOutput)
 	if err != nil {
-		return nil, "", err
+		return nil, err
+	}
+
+	if contractName == "" {
+		if len(compiledOutput) != 1 {
+			names := make([]string, 0, len(compiledOutput))
+			for name := range compiledOutput {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("source defines %d contracts (%s), name the one to deploy", len(names), strings.Join(names, ", "))
+		}
+		for name := range compiledOutput {
+			contractName = name
+		}
+	}
+	output, ok := compiledOutput[contractName]
+	if !ok {
+		return nil, fmt.Errorf("contract %s not found in source", contractName)
 	}
 
 	var abi interface{}
-	var bytecode string
+	compiled := CompiledContract{Name: contractName}
 
-	if simpleStorage, ok := compiledOutput["SimpleStorage"]; ok {
-		if abiData, ok := simpleStorage["abi"]; ok {
-			abi = abiData
+	if abiData, ok := output["abi"]; ok {
+		abi = abiData
+	}
+	if evmData, ok := output["evm"].(map[string]interface{}); ok {
+		if bytecodeData, ok := evmData["bytecode"].(map[string]interface{}); ok {
+			compiled.Bytecode, _ = bytecodeData["object"].(string)
+			compiled.SourceMap, _ = bytecodeData["sourceMap"].(string)
 		}
-		if evmData, ok := simpleStorage["evm"].(map[string]interface{}); ok {
-			if bytecodeData, ok := evmData["bytecode"].(map[string]interface{}); ok {
-				bytecode = bytecodeData["object"].(string)
-			}
+		if deployedData, ok := evmData["deployedBytecode"].(map[string]interface{}); ok {
+			compiled.DeployedSourceMap, _ = deployedData["sourceMap"].(string)
 		}
 	}
 
-	if abi == nil || len(bytecode) == 0 {
-		return nil, "", errors.New("failed to extract ABI and bytecode from compiled contract")
+	if abi == nil || len(compiled.Bytecode) == 0 {
+		return nil, errors.New("failed to extract ABI and bytecode from compiled contract")
 	}
 
-	abiBytes, err := json.Marshal(abi)
+	compiled.ABI, err = json.Marshal(abi)
 	if err != nil {
-		return nil, "", errors.New("failed to marshal ABI into byte slice")
+		return nil, errors.New("failed to marshal ABI into byte slice")
 	}
 
-	return abiBytes, bytecode, nil
+	return &compiled, nil
 }
 
 func CreateContract(contract *Contract, handler ContractHandler) (interface{}, error) {
 	// Compile the Solidity source code to get ABI and bytecode
-	abiBytes, bytecode, err := CompileSoliditySource(contract.SoliditySource)
+	compiled, err := CompileSoliditySource(contract.SoliditySource, contract.Name)
 	if err != nil {
 		return nil, err
 	}
 
-	// Set the contract ABI and bytecode
-	contract.ABI = abiBytes
-	contract.Bytecode = bytecode
+	// Set the contract ABI and bytecode, and the source maps to trace them back
+	contract.ABI = compiled.ABI
+	contract.Bytecode = compiled.Bytecode
+	contract.SourceMap = compiled.SourceMap
+	contract.DeployedSourceMap = compiled.DeployedSourceMap
 
-	err = storage.DB.Save(contract)
+	// Deploy first, so that the contract is saved with its on-chain address
+	err = handler.DeployContract(contract)
 	if err != nil {
 		return nil, err
 	}
+	if contract.ID == "" {
+		contract.ID = contract.Address
+	}
 
-	err = handler.DeployContract(contract)
+	err = storage.DB.Save(contract)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,186 @@
+package contracts
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"smartley-contracts/types"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/holiman/uint256"
+)
+
+// TestExecuteSelector checks that calls are made with the selector of the
+// function's canonical signature, in which tuple parameters are spelled out.
+func TestExecuteSelector(t *testing.T) {
+	env := newTestEnv(nil)
+	env.ABI = []byte(`[{"type":"function","name":"submit","stateMutability":"nonpayable","inputs":[{"name":"order","type":"tuple","components":[{"name":"amount","type":"uint256"},{"name":"owner","type":"address"}]}],"outputs":[]}]`)
+
+	// Return the first four bytes of the calldata
+	code := []byte{0x5f, 0x35, 0x5f, 0x52, 0x60, 0x04, 0x5f, 0xf3} // PUSH0, CALLDATALOAD, PUSH0, MSTORE, PUSH1 4, PUSH0, RETURN
+	result, err := env.Execute(code, "submit", nil)
+	if err != nil {
+		t.Fatalf("execution failed: %v", err)
+	}
+	want := crypto.Keccak256([]byte("submit((uint256,address))"))[:4]
+	if got := result.([]byte); !bytes.Equal(got, want) {
+		t.Errorf("selector %x, want %x", got, want)
+	}
+}
+
+// TestExecuteInputWithoutState checks that a call made without a world state
+// cannot send value, as there is no account to take it from.
+func TestExecuteInputWithoutState(t *testing.T) {
+	env := newTestEnv(nil)
+	env.State = nil
+	env.Storage = types.NewStorage()
+	env.Context.Value = uint256.NewInt(1)
+
+	if _, err := env.ExecuteInput([]byte{0x00}, nil); !errors.Is(err, ErrInsufficientBalance) {
+		t.Errorf("error %v, want %v", err, ErrInsufficientBalance)
+	}
+}
+
+// TestImplicitStop checks that running past the end of the code stops the
+// frame successfully, as STOP does, for calls, deployments and CREATE.
+func TestImplicitStop(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+	}{
+		{"empty", ""},
+		{"after_push", "6001"},
+		{"truncated_push", "61ff"},
+		{"after_sstore", "6001600055"}, // PUSH1 1, PUSH1 0, SSTORE
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _ := hex.DecodeString(tt.code)
+			env := newTestEnv(nil)
+			result, err := env.ExecuteInput(code, nil)
+			if err != nil {
+				t.Fatalf("execution failed: %v", err)
+			}
+			if output, _ := result.([]byte); len(output) != 0 {
+				t.Errorf("output %x, want none", output)
+			}
+		})
+	}
+
+	t.Run("deployment", func(t *testing.T) {
+		env := newTestEnv(nil)
+		if _, err := env.Deploy([]byte{0x60, 0x01, 0x60, 0x00}, nil); err != nil { // PUSH1 1, PUSH1 0
+			t.Fatalf("deployment failed: %v", err)
+		}
+		if len(env.Bytecode) != 0 {
+			t.Errorf("deployed code %x, want none", env.Bytecode)
+		}
+	})
+
+	t.Run("create", func(t *testing.T) {
+		// CREATE with the init code 60016000 and return the new address
+		code, _ := hex.DecodeString("63600160005f52" + "600460" + "1c5ff0" + "5f5260205ff3")
+		result, err := newTestEnv(nil).ExecuteInput(code, nil)
+		if err != nil {
+			t.Fatalf("execution failed: %v", err)
+		}
+		want := CreateAddress(testAddress, 0)
+		if got := common.BytesToAddress(result.([]byte)); got != want {
+			t.Errorf("created %s, want %s", got.Hex(), want.Hex())
+		}
+	})
+}
+
+// accountDump is what a test compares of an account.
+type accountDump struct {
+	Balance string
+	Nonce   uint64
+	Code    string
+	Storage map[common.Hash]common.Hash
+}
+
+// dumpAccounts copies what tests compare of every account in accounts.
+func dumpAccounts(accounts map[common.Address]*types.Storage) map[common.Address]accountDump {
+	dump := make(map[common.Address]accountDump, len(accounts))
+	for address, account := range accounts {
+		storage := make(map[common.Hash]common.Hash)
+		account.ForEachState(func(key, value common.Hash) { storage[key] = value })
+		dump[address] = accountDump{
+			Balance: account.GetBalance().Dec(),
+			Nonce:   account.GetNonce(),
+			Code:    hex.EncodeToString(account.GetBytecode()),
+			Storage: storage,
+		}
+	}
+	return dump
+}
+
+// TestSimulateLeavesStateUnchanged simulates a call that stores, sends value
+// and creates contracts, itself and through a nested call, and checks that
+// no account changes, while the same call made for real changes them.
+func TestSimulateLeavesStateUnchanged(t *testing.T) {
+	caller := common.HexToAddress("0x00000000000000000000000000000000000ca11e")
+	callee := common.HexToAddress("0x0000000000000000000000000000000000ca11ee")
+	accounts := map[common.Address]*types.Storage{
+		caller:      types.NewStorage(),
+		testAddress: types.NewStorage(),
+		callee:      types.NewStorage(),
+	}
+	accounts[caller].SetBalance(uint256.NewInt(1000))
+	accounts[testAddress].SetBalance(uint256.NewInt(100))
+	accounts[testAddress].SetState(common.Hash{}, common.HexToHash("0x09"))
+	// PUSH1 2, PUSH0, SSTORE, then CREATE an empty contract
+	accounts[callee].SetBytecode(common.FromHex("60025f55" + "5f5f5ff050"))
+
+	// PUSH1 1, PUSH0, SSTORE; CALL the callee with 5 wei; CREATE a contract,
+	// with 1 wei, whose init code stores 1
+	code := common.FromHex("60015f55" +
+		"5f5f5f5f600573" + callee.Hex()[2:] + "5af150" +
+		"6360015f555f52" + "6004601c6001f050")
+	accounts[testAddress].SetBytecode(code)
+
+	env := newTestEnv(accounts)
+	env.ABI = []byte(`[{"type":"function","name":"poke","stateMutability":"payable","inputs":[],"outputs":[]}]`)
+	env.Bytecode = code
+	env.Context.Value = uint256.NewInt(7)
+
+	before := dumpAccounts(accounts)
+	if _, err := env.Simulate("poke", nil); err != nil {
+		t.Fatalf("simulation failed: %v", err)
+	}
+	if after := dumpAccounts(accounts); !reflect.DeepEqual(after, before) {
+		t.Errorf("simulation changed the accounts from\n%+v\nto\n%+v", before, after)
+	}
+
+	// The same call, made for real, changes all of them
+	if _, err := env.ExecuteWithArgs("poke", nil); err != nil {
+		t.Fatalf("execution failed: %v", err)
+	}
+	created := CreateAddress(testAddress, 0)
+	nestedCreated := CreateAddress(callee, 0)
+	checks := []struct {
+		name      string
+		got, want string
+	}{
+		{"caller balance", accounts[caller].GetBalance().Dec(), "993"},
+		{"contract balance", accounts[testAddress].GetBalance().Dec(), "101"},
+		{"contract slot", accounts[testAddress].GetState(common.Hash{}).Hex(), common.HexToHash("0x01").Hex()},
+		{"callee balance", accounts[callee].GetBalance().Dec(), "5"},
+		{"callee slot", accounts[callee].GetState(common.Hash{}).Hex(), common.HexToHash("0x02").Hex()},
+		{"created slot", accounts[created].GetState(common.Hash{}).Hex(), common.HexToHash("0x01").Hex()},
+		{"created balance", accounts[created].GetBalance().Dec(), "1"},
+		{"nested created exists", strconv.FormatBool(accounts[nestedCreated] != nil), "true"},
+		{"contract nonce", strconv.FormatUint(accounts[testAddress].GetNonce(), 10), "1"},
+		{"callee nonce", strconv.FormatUint(accounts[callee].GetNonce(), 10), "1"},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("%s %s, want %s", c.name, c.got, c.want)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package contracts
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"smartley-contracts/types"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/holiman/uint256"
+)
+
+const (
+	// maxCodeSize bounds the runtime code a contract may deploy (EIP-170).
+	maxCodeSize = 24576
+
+	// maxInitCodeSize bounds the init code run by a creation (EIP-3860).
+	maxInitCodeSize = 2 * maxCodeSize
+)
+
+// CreateAddress returns the address of the contract deployed by creator when
+// its nonce is nonce, as computed by CREATE: keccak256(rlp([creator, nonce]))[12:].
+func CreateAddress(creator common.Address, nonce uint64) common.Address {
+	return crypto.CreateAddress(creator, nonce)
+}
+
+// CreateAddress2 returns the address of the contract deployed by CREATE2:
+// keccak256(0xff ++ creator ++ salt ++ keccak256(initCode))[12:].
+func CreateAddress2(creator common.Address, salt common.Hash, initCode []byte) common.Address {
+	return crypto.CreateAddress2(creator, salt, crypto.Keccak256(initCode))
+}
+
+// Deploy runs a deployment transaction from env.Context.Caller: it appends the
+// ABI-encoded constructor arguments to initCode, runs the result as init code
+// and installs the code it returns at the address derived from the caller's
+// nonce. On success env.Context.Address and env.Bytecode are set to the new
+// contract's address and runtime code, and the result value is the address.
+// As with ExecuteWithArgs, a failed deployment still reports the gas it used.
+func (env *VMExecutionEnvironment) Deploy(initCode []byte, args []interface{}) (*ExecutionResult, error) {
+	var parsedABI abi.ABI
+	if len(env.ABI) > 0 {
+		var err error
+		if parsedABI, err = abi.JSON(bytes.NewReader(env.ABI)); err != nil {
+			return nil, fmt.Errorf("failed to parse ABI: %v", err)
+		}
+	}
+	encodedArgs, err := parsedABI.Constructor.Inputs.Pack(args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode constructor arguments: %v", err)
+	}
+	data := append(append([]byte{}, initCode...), encodedArgs...)
+
+	// Charge the intrinsic cost of the deployment before any code runs
+	env.GasUsed = 0
+	if len(data) > maxInitCodeSize {
+		return nil, ErrMaxInitCodeSizeExceeded
+	}
+	intrinsic := intrinsicGas(data, true)
+	if env.GasLimit < intrinsic {
+		return nil, fmt.Errorf("%w: have %d, want %d", ErrIntrinsicGas, env.GasLimit, intrinsic)
+	}
+	env.Gas = env.GasLimit - intrinsic
+	env.returnData = nil
+	env.logs = nil
+	if env.Tracer != nil {
+		env.Tracer.CaptureTxStart(env.GasLimit)
+		defer func() { env.Tracer.CaptureTxEnd(env.GasUsed) }()
+	}
+
+	// Without a world state the new contract is deployed into a private one
+	// and kept in env.Storage. As in ExecuteInput, the deployer has no account
+	// there, so it has no balance to send value from.
+	value := wordOrZero(env.Context.Value)
+	if env.State == nil {
+		accounts := make(map[common.Address]*types.Storage)
+		env.State = NewStateDB(accounts)
+		defer func() {
+			env.Storage = accounts[env.Context.Address]
+			env.State = nil
+		}()
+	}
+	state := env.State
+
+	sender := env.Context.Caller
+	env.Context.Address = CreateAddress(sender, state.GetNonce(sender))
+	env.prepareAccessList()
+
+	// The init code runs as the outermost frame, at the depth ExecuteInput
+	// runs a call's code at
+	env.depth = -1
+	code, gasLeft, err := env.create(sender, env.Context.Address, data, env.Gas, value, false)
+	env.depth = 0
+	env.Gas = gasLeft
+	if err == nil {
+		refund := state.GetRefund()
+		if maxRefund := (env.GasLimit - env.Gas) / maxRefundQuotient; refund > maxRefund {
+			refund = maxRefund
+		}
+		env.Gas += refund
+		state.GetStorage(env.Context.Address).SetABI(env.ABI)
+		env.Bytecode = code
+		env.logs = state.Logs()
+		env.decodeLogs()
+	}
+	env.GasUsed = env.GasLimit - env.Gas
+
+	// create has already rolled back a failed deployment; committing keeps the
+	// sender's nonce increment, which a failed deployment still consumes.
+	state.Commit()
+
+	if err != nil {
+		var revertErr *RevertError
+		if errors.As(err, &revertErr) {
+			revertErr.decode(&parsedABI)
+		}
+		return &ExecutionResult{GasUsed: env.GasUsed}, err
+	}
+	return &ExecutionResult{ReturnValue: env.Context.Address, GasUsed: env.GasUsed, Logs: env.Logs()}, nil
+}
+
+// opCreate implements CREATE and, when salted is set, CREATE2. It runs the init
+// code taken from memory and pushes the new contract's address, or 0 if the
+// creation failed.
+func (env *VMExecutionEnvironment) opCreate(salted bool) error {
+	if env.readOnly {
+		return ErrWriteProtection
+	}
+	value, offset, size := env.pop(), env.pop(), env.pop()
+	var salt uint256.Int
+	if salted {
+		salt = env.pop()
+	}
+
+	offset64, size64, err := env.expandMemory(&offset, &size)
+	if err != nil {
+		return err
+	}
+	if size64 > maxInitCodeSize {
+		return ErrMaxInitCodeSizeExceeded
+	}
+	gas := gasInitCodeWord * toWordSize(size64)
+	if salted {
+		gas += gasKeccak256Word * toWordSize(size64)
+	}
+	if !env.useGas(gas) {
+		return ErrOutOfGas
+	}
+
+	initCode := env.Memory.GetCopy(offset64, size64)
+	creator := env.Context.Address
+	address := CreateAddress(creator, env.State.GetNonce(creator))
+	if salted {
+		address = CreateAddress2(creator, salt.Bytes32(), initCode)
+	}
+
+	// The init code gets all but one 64th of the remaining gas (EIP-150)
+	if env.Tracer != nil {
+		env.traceStep(nil)
+	}
+	initGas := env.Gas - env.Gas/64
+	env.Gas -= initGas
+	ret, gasLeft, err := env.create(creator, address, initCode, initGas, &value, salted)
+	env.Gas += gasLeft
+
+	var revertErr *RevertError
+	if errors.As(err, &revertErr) {
+		env.returnData = ret
+	} else {
+		env.returnData = nil
+	}
+	if err != nil {
+		env.push(new(uint256.Int))
+		return nil
+	}
+	env.push(addressWord(address))
+	return nil
+}
+
+// create deploys a contract at address on behalf of creator: it bumps the
+// creator's nonce, runs initCode in a new frame and stores the code that frame
+// returns as the account's code. It returns that code together with the unused
+// gas. As with runFrame, a failed creation is rolled back, and only a revert
+// returns any gas. salted tells the tracer the creation was made by CREATE2.
+func (env *VMExecutionEnvironment) create(creator, address common.Address, initCode []byte, gas uint64, value *uint256.Int, salted bool) (ret []byte, gasLeft uint64, err error) {
+	if env.depth+1 > maxCallDepth {
+		return nil, gas, ErrDepth
+	}
+	if !env.State.CanTransfer(creator, value) {
+		return nil, gas, ErrInsufficientBalance
+	}
+	nonce := env.State.GetNonce(creator)
+	env.State.SetNonce(creator, nonce+1)
+	env.State.AddAddressToAccessList(address)
+	if env.State.GetNonce(address) != 0 || len(env.State.GetCode(address)) != 0 {
+		return nil, 0, ErrContractAddressCollision
+	}
+
+	snapshot := env.State.Snapshot()
+	env.State.CreateAccount(address)
+	env.State.SetNonce(address, 1) // Contracts start at nonce 1 (EIP-161)
+	env.State.Transfer(creator, address, value)
+	if env.Tracer != nil {
+		typ := "CREATE"
+		if salted {
+			typ = "CREATE2"
+		}
+		env.Tracer.CaptureEnter(typ, creator, address, initCode, gas, value)
+		defer func() { env.Tracer.CaptureExit(ret, gas-gasLeft, err) }()
+	}
+
+	ctx := env.Context
+	ctx.Caller = creator
+	ctx.Address = address
+	ctx.Value = value
+	frame := &VMExecutionEnvironment{
+		Bytecode: initCode,
+		GasLimit: gas,
+		Gas:      gas,
+		Context:  ctx,
+		State:    env.State,
+		Tracer:   env.Tracer,
+		depth:    env.depth + 1,
+	}
+	result, err := frame.ExecuteBytecode(initCode, nil)
+	code, _ := result.([]byte)
+	if err == nil {
+		err = frame.depositCode(code)
+	}
+	if err != nil {
+		env.State.RevertToSnapshot(snapshot)
+		var revertErr *RevertError
+		if errors.As(err, &revertErr) {
+			return revertErr.Data, frame.Gas, err
+		}
+		return nil, 0, err
+	}
+	return code, frame.Gas, nil
+}
+
+// depositCode checks the runtime code returned by init code, charges for
+// storing it and installs it as the code of the frame's account.
+func (env *VMExecutionEnvironment) depositCode(code []byte) error {
+	if len(code) > maxCodeSize {
+		return ErrMaxCodeSizeExceeded
+	}
+	if len(code) > 0 && code[0] == 0xef {
+		return ErrInvalidCode
+	}
+	if !env.useGas(gasCreateData * uint64(len(code))) {
+		return ErrCodeStoreOutOfGas
+	}
+	env.State.SetCode(env.Context.Address, code)
+	return nil
+}
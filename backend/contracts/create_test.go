@@ -0,0 +1,218 @@
+package contracts
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"smartley-contracts/types"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/uint256"
+)
+
+// TestCreateAddress checks the addresses of CREATE against known values and
+// those of CREATE2 against the examples of EIP-1014.
+func TestCreateAddress(t *testing.T) {
+	creator := common.HexToAddress("0x6ac7ea33f8831ea9dcc53393aaa88b25a785dbf0")
+	for nonce, want := range []string{
+		"0xcd234a471b72ba2f1ccf0a70fcaba648a5eecd8d",
+		"0x343c43a37d37dff08ae8c4a11544c718abb4fcf8",
+		"0xf778b86fa74e846c4f0a1fbd1335fe81c00a0c91",
+	} {
+		if got := CreateAddress(creator, uint64(nonce)); got != common.HexToAddress(want) {
+			t.Errorf("CREATE with nonce %d: %s, want %s", nonce, got.Hex(), want)
+		}
+	}
+
+	tests := []struct {
+		creator  string
+		salt     string
+		initCode string
+		want     string
+	}{
+		{"0x0000000000000000000000000000000000000000", "0x00", "0x00", "0x4D1A2e2bB4F88F0250f26Ffff098B0b30B26BF38"},
+		{"0xdeadbeef00000000000000000000000000000000", "0x00", "0x00", "0xB928f69Bb1D91Cd65274e3c79d8986362984fDA3"},
+		{"0xdeadbeef00000000000000000000000000000000", "0x000000000000000000000000feed000000000000000000000000000000000000", "0x00", "0xD04116cDd17beBE565EB2422F2497E06cC1C9833"},
+		{"0x0000000000000000000000000000000000000000", "0x00", "0xdeadbeef", "0x70f2b2914A2a4b783FaEFb75f459A580616Fcb5e"},
+		{"0x00000000000000000000000000000000deadbeef", "0xcafebabe", "0xdeadbeef", "0x60f3f640a8508fC6a86d45DF051962668E1e8AC7"},
+		{"0x00000000000000000000000000000000deadbeef", "0xcafebabe", "0xdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeef", "0x1d8bfDC5D46DC4f61D6b6115972536eBE6A8854C"},
+		{"0x0000000000000000000000000000000000000000", "0x00", "0x", "0xE33C0C7F7df4809055C3ebA6c09CFe4BaF1BD9e0"},
+	}
+	for i, tt := range tests {
+		got := CreateAddress2(common.HexToAddress(tt.creator), common.HexToHash(tt.salt), common.FromHex(tt.initCode))
+		if got != common.HexToAddress(tt.want) {
+			t.Errorf("EIP-1014 example %d: %s, want %s", i, got.Hex(), tt.want)
+		}
+	}
+}
+
+// TestCreateOpcodes runs CREATE and CREATE2 and checks the addresses they
+// return, the creator's nonce they leave, and that creating at an address
+// already in use fails.
+func TestCreateOpcodes(t *testing.T) {
+	// Init code 60016000 (PUSH1 1, PUSH1 0), stored at memory offset 28
+	const storeInitCode = "63600160005f52"
+	initCode := common.FromHex("60016000")
+	salt := common.BigToHash(common.Big2)
+	created2 := CreateAddress2(testAddress, salt, initCode)
+
+	tests := []struct {
+		name     string
+		code     string // Stores the created addresses at 0x20, 0x40, ...
+		existing map[common.Address]*types.Storage
+		want     []common.Address // Created addresses, zero for a failed creation
+		nonce    uint64           // Nonce of the creator afterwards
+	}{
+		{
+			name: "create",
+			code: "5f5f5ff0602052" + "5f5f5ff0604052", // CREATE with empty init code, twice
+			want: []common.Address{CreateAddress(testAddress, 0), CreateAddress(testAddress, 1)},
+			// Each CREATE uses a nonce up
+			nonce: 2,
+		},
+		{
+			name:  "create2",
+			code:  storeInitCode + "60026004601c5ff5602052", // CREATE2 with salt 2
+			want:  []common.Address{created2},
+			nonce: 1,
+		},
+		{
+			name:  "create2_twice",
+			code:  storeInitCode + "60026004601c5ff5602052" + "60026004601c5ff5604052",
+			want:  []common.Address{created2, {}},
+			nonce: 2,
+		},
+		{
+			name:     "existing_nonce",
+			code:     "5f5f5ff0602052" + "5f5f5ff0604052",
+			existing: map[common.Address]*types.Storage{CreateAddress(testAddress, 0): accountWith(1, nil)},
+			// The failed creation still uses the nonce up
+			want:  []common.Address{{}, CreateAddress(testAddress, 1)},
+			nonce: 2,
+		},
+		{
+			name:     "existing_code",
+			code:     storeInitCode + "60026004601c5ff5602052",
+			existing: map[common.Address]*types.Storage{created2: accountWith(0, []byte{0x00})},
+			want:     []common.Address{{}},
+			nonce:    1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			accounts := make(map[common.Address]*types.Storage)
+			for address, account := range tt.existing {
+				accounts[address] = account
+			}
+			env := newTestEnv(accounts)
+
+			// Return the created addresses
+			code := common.FromHex(tt.code)
+			code = append(code, 0x60, byte(32*len(tt.want)), 0x60, 0x20, 0xf3) // PUSH1 size, PUSH1 32, RETURN
+			result, err := env.ExecuteInput(code, nil)
+			if err != nil {
+				t.Fatalf("execution failed: %v", err)
+			}
+			output := result.([]byte)
+			for i, want := range tt.want {
+				if got := common.BytesToAddress(output[32*i : 32*(i+1)]); got != want {
+					t.Errorf("creation %d returned %s, want %s", i, got.Hex(), want.Hex())
+				}
+				if want != (common.Address{}) && (accounts[want] == nil || accounts[want].GetNonce() != 1) {
+					t.Errorf("creation %d left no account with nonce 1", i)
+				}
+			}
+			if nonce := accounts[testAddress].GetNonce(); nonce != tt.nonce {
+				t.Errorf("creator nonce %d, want %d", nonce, tt.nonce)
+			}
+		})
+	}
+}
+
+// accountWith returns an account with the given nonce and code.
+func accountWith(nonce uint64, code []byte) *types.Storage {
+	account := types.NewStorage()
+	account.SetNonce(nonce)
+	account.SetBytecode(code)
+	return account
+}
+
+// TestDeployCodeRules checks the limits on the code a deployment returns: its
+// size (EIP-170), its first byte (EIP-3541) and the gas to store it. Failed
+// deployments still use the deployer's nonce up.
+func TestDeployCodeRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		initCode string
+		wantErr  error
+		codeSize int
+	}{
+		{"max_size", "6160005ff3", nil, maxCodeSize},               // RETURN 24576 bytes
+		{"over_max_size", "6160015ff3", ErrMaxCodeSizeExceeded, 0}, // RETURN 24577 bytes
+		{"leading_ef", "60ef5f5360015ff3", ErrInvalidCode, 0},      // MSTORE8 0xef, RETURN 1 byte
+		{"leading_fe", "60fe5f5360015ff3", nil, 1},                 // MSTORE8 0xfe, RETURN 1 byte
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(nil)
+			env.GasLimit = 10_000_000
+			deployer := env.Context.Caller
+			address := CreateAddress(deployer, 0)
+
+			_, err := env.Deploy(common.FromHex(tt.initCode), nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error %v, want %v", err, tt.wantErr)
+			}
+			if size := len(env.State.GetCode(address)); size != tt.codeSize {
+				t.Errorf("deployed %d bytes of code, want %d", size, tt.codeSize)
+			}
+			if nonce := env.State.GetNonce(deployer); nonce != 1 {
+				t.Errorf("deployer nonce %d, want 1", nonce)
+			}
+		})
+	}
+
+	// Storing the code is charged last, so a deployment given one unit of gas
+	// less than it uses runs out of gas storing it
+	initCode := common.FromHex("60645ff3") // RETURN 100 bytes
+	env := newTestEnv(nil)
+	result, err := env.Deploy(initCode, nil)
+	if err != nil {
+		t.Fatalf("deployment failed: %v", err)
+	}
+	env = newTestEnv(nil)
+	env.GasLimit = result.GasUsed - 1
+	if _, err := env.Deploy(initCode, nil); !errors.Is(err, ErrCodeStoreOutOfGas) {
+		t.Errorf("error %v, want %v", err, ErrCodeStoreOutOfGas)
+	}
+	if code := env.State.GetCode(CreateAddress(env.Context.Caller, 0)); len(code) != 0 {
+		t.Errorf("deployed %x without paying for it", code)
+	}
+	if nonce := env.State.GetNonce(env.Context.Caller); nonce != 1 {
+		t.Errorf("deployer nonce %d, want 1", nonce)
+	}
+}
+
+// TestDeployWithoutState checks that a deployment made without a world state
+// keeps the new contract in env.Storage, and cannot send value.
+func TestDeployWithoutState(t *testing.T) {
+	runtime := []byte{0x00}
+	initCode := []byte{0x60, 0x01, 0x60, 0x1f, 0xf3} // PUSH1 1, PUSH1 31, RETURN
+
+	env := newTestEnv(nil)
+	env.State = nil
+	if _, err := env.Deploy(initCode, nil); err != nil {
+		t.Fatalf("deployment failed: %v", err)
+	}
+	if env.Storage == nil || !bytes.Equal(env.Storage.GetBytecode(), runtime) {
+		t.Errorf("storage %+v, want the deployed code", env.Storage)
+	}
+
+	env = newTestEnv(nil)
+	env.State = nil
+	env.Context.Value = uint256.NewInt(1)
+	if _, err := env.Deploy(initCode, nil); !errors.Is(err, ErrInsufficientBalance) {
+		t.Errorf("error %v, want %v", err, ErrInsufficientBalance)
+	}
+}
@@ -0,0 +1,104 @@
+package contracts
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/holiman/uint256"
+)
+
+var (
+	// ErrOutOfGas is returned when execution needs more gas than remains.
+	// State changes made by the call are discarded and all its gas is consumed.
+	ErrOutOfGas = errors.New("out of gas")
+
+	// ErrIntrinsicGas is returned when the gas limit does not even cover the
+	// flat call cost and calldata.
+	ErrIntrinsicGas = errors.New("intrinsic gas too low")
+
+	// ErrInsufficientBalance is returned when an account is asked to transfer
+	// more value than it holds.
+	ErrInsufficientBalance = errors.New("insufficient balance for transfer")
+
+	// ErrWriteProtection is returned when code running under STATICCALL tries
+	// to modify state.
+	ErrWriteProtection = errors.New("write protection")
+
+	// ErrDepth is returned by a call made beyond the maximum call depth.
+	ErrDepth = errors.New("max call depth exceeded")
+
+	// ErrContractAddressCollision is returned when a contract is created at an
+	// address that already holds code or has a non-zero nonce.
+	ErrContractAddressCollision = errors.New("contract address collision")
+
+	// ErrMaxInitCodeSizeExceeded is returned when init code is larger than
+	// maxInitCodeSize.
+	ErrMaxInitCodeSizeExceeded = errors.New("max initcode size exceeded")
+
+	// ErrMaxCodeSizeExceeded is returned when init code returns runtime code
+	// larger than maxCodeSize.
+	ErrMaxCodeSizeExceeded = errors.New("max code size exceeded")
+
+	// ErrInvalidCode is returned when init code returns runtime code starting
+	// with the reserved 0xEF byte (EIP-3541).
+	ErrInvalidCode = errors.New("invalid code: must not begin with 0xef")
+
+	// ErrCodeStoreOutOfGas is returned when too little gas is left to pay for
+	// storing the runtime code returned by init code.
+	ErrCodeStoreOutOfGas = errors.New("contract creation code storage out of gas")
+
+	// ErrReturnDataOutOfBounds is returned when RETURNDATACOPY reads past the
+	// end of the last call's output.
+	ErrReturnDataOutOfBounds = errors.New("return data out of bounds")
+)
+
+// InvalidJumpError is returned by ExecuteBytecode when JUMP or JUMPI targets a
+// position that is not a JUMPDEST, including positions inside PUSH data.
+type InvalidJumpError struct {
+	PC          int
+	Destination uint256.Int
+}
+
+func (e *InvalidJumpError) Error() string {
+	return fmt.Sprintf("invalid jump destination %s at pc %d", e.Destination.Dec(), e.PC)
+}
+
+// RevertError is returned when execution ends with the REVERT opcode. Data is
+// the raw revert payload; the remaining fields are filled in when the payload
+// can be decoded as Error(string), Panic(uint256) or a custom error declared in
+// the contract ABI.
+type RevertError struct {
+	Data   hexutil.Bytes          `json:"data"`
+	Name   string                 `json:"name,omitempty"`
+	Reason string                 `json:"reason,omitempty"`
+	Args   map[string]interface{} `json:"args,omitempty"`
+}
+
+func (e *RevertError) Error() string {
+	if e.Reason != "" {
+		return "execution reverted: " + e.Reason
+	}
+	if e.Name != "" {
+		return "execution reverted: " + e.Name
+	}
+	return "execution reverted"
+}
+
+// ExecutionError is returned by ExecuteBytecode when a frame fails, and records
+// which instruction of the frame's code failed so that the failure can be traced
+// back to source. Its message is that of Err, which it wraps.
+type ExecutionError struct {
+	Address common.Address // account whose code was running
+	PC      uint64         // position of the failing instruction
+	Err     error
+}
+
+func (e *ExecutionError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ExecutionError) Unwrap() error {
+	return e.Err
+}
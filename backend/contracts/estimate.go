@@ -0,0 +1,63 @@
+package contracts
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+// EstimateGas returns the smallest gas limit with which a call to a contract
+// function succeeds, searching between the gas the call uses and env.GasLimit,
+// or DefaultGasLimit if that is not set. Every trial runs as Simulate does, so
+// the state is left unchanged. If the call fails even with the full limit the
+// error says why; a revert is returned as a decoded *RevertError.
+func (env *VMExecutionEnvironment) EstimateGas(functionSignature string, args []interface{}) (uint64, error) {
+	parsedABI, err := abi.JSON(bytes.NewReader(env.ABI))
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse ABI: %v", err)
+	}
+	input, err := parsedABI.Pack(functionSignature, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode arguments: %v", err)
+	}
+
+	hi := env.GasLimit
+	if hi == 0 {
+		hi = DefaultGasLimit
+	}
+	defer func(gasLimit uint64) { env.GasLimit = gasLimit }(env.GasLimit)
+	run := func(gasLimit uint64) error {
+		defer env.startSimulation()()
+		env.GasLimit = gasLimit
+		_, err := env.ExecuteInput(env.Bytecode, input)
+		return err
+	}
+
+	// A call that fails with all the gas allowed fails with any limit
+	if err := run(hi); err != nil {
+		var revertErr *RevertError
+		if errors.As(err, &revertErr) {
+			revertErr.decode(&parsedABI)
+			return 0, err
+		}
+		if errors.Is(err, ErrOutOfGas) {
+			return 0, fmt.Errorf("%w: gas required exceeds allowance (%d)", ErrOutOfGas, hi)
+		}
+		return 0, err
+	}
+
+	// No limit below the gas the call used can be enough. Refunds are only
+	// paid out at the end, so the call may need more than it used.
+	lo := env.GasUsed - 1
+	for lo+1 < hi {
+		mid := lo + (hi-lo)/2
+		if run(mid) == nil {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	return hi, nil
+}
@@ -0,0 +1,169 @@
+package contracts
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/uint256"
+)
+
+// DefaultGasLimit is the gas available to a call when the caller does not set
+// VMExecutionEnvironment.GasLimit explicitly.
+const DefaultGasLimit uint64 = 30_000_000
+
+// Gas schedule constants, following the London fork of the Ethereum Yellow Paper.
+const (
+	gasTxBase            uint64 = 21000 // intrinsic cost of every call
+	gasTxCreate          uint64 = 53000 // intrinsic cost of a deployment
+	gasTxDataZero        uint64 = 4     // per zero byte of calldata
+	gasTxDataNonZero     uint64 = 16    // per non-zero byte of calldata
+	gasMemory            uint64 = 3     // linear coefficient of memory expansion
+	gasQuadCoeffDiv      uint64 = 512   // quadratic divisor of memory expansion
+	gasCopyWord          uint64 = 3     // per word copied by *COPY opcodes
+	gasExpByte           uint64 = 50    // per byte of the EXP exponent
+	gasWarmStorageRead   uint64 = 100   // SLOAD/SSTORE of an already accessed slot
+	gasColdSload         uint64 = 2100  // first access of a slot in a call
+	gasSstoreSet         uint64 = 20000 // zero to non-zero
+	gasSstoreReset       uint64 = 5000  // non-zero to a different value, cold surcharge included
+	gasSstoreSentry      uint64 = 2300  // SSTORE fails if no more than this is left
+	gasSstoreClearsRef   uint64 = 4800  // refund for clearing a slot
+	gasColdAccountAccess uint64 = 2600  // first access of an account in a transaction
+	gasCallValue         uint64 = 9000  // CALL or CALLCODE transferring a non-zero value
+	gasCallStipend       uint64 = 2300  // free gas given to the callee of a value transfer
+	gasCallNewAccount    uint64 = 25000 // CALL transferring value to an empty account
+	gasCreate            uint64 = 32000 // CREATE and CREATE2
+	gasCreateData        uint64 = 200   // per byte of deployed code
+	gasInitCodeWord      uint64 = 2     // per word of init code (EIP-3860)
+	gasKeccak256         uint64 = 30    // KECCAK256
+	gasKeccak256Word     uint64 = 6     // per word hashed
+	gasLog               uint64 = 375   // every LOG opcode
+	gasLogTopic          uint64 = 375   // per LOG topic
+	gasLogData           uint64 = 8     // per byte of LOG data
+	maxRefundQuotient    uint64 = 5     // refunds are capped at gasUsed / 5
+)
+
+// Gas tiers shared by most fixed-cost opcodes.
+const (
+	gasZero    uint64 = 0
+	gasJumpDst uint64 = 1
+	gasQuick   uint64 = 2
+	gasFastest uint64 = 3
+	gasFast    uint64 = 5
+	gasMid     uint64 = 8
+	gasSlow    uint64 = 10
+	gasExtStep uint64 = 20
+)
+
+// intrinsicGas returns the gas charged before any code runs: the flat call
+// cost plus the calldata cost. A deployment also pays for its init code words.
+func intrinsicGas(inputData []byte, creation bool) uint64 {
+	gas := gasTxBase
+	if creation {
+		gas = gasTxCreate + gasInitCodeWord*toWordSize(uint64(len(inputData)))
+	}
+	for _, b := range inputData {
+		if b == 0 {
+			gas += gasTxDataZero
+		} else {
+			gas += gasTxDataNonZero
+		}
+	}
+	return gas
+}
+
+// memoryGasCost returns the total cost of a memory of the given size in bytes.
+// Expansion is charged as the difference between the new and old totals.
+func memoryGasCost(size uint64) uint64 {
+	words := toWordSize(size)
+	return words*gasMemory + words*words/gasQuadCoeffDiv
+}
+
+// toWordSize rounds a byte size up to whole 32-byte words.
+func toWordSize(size uint64) uint64 {
+	return (size + 31) / 32
+}
+
+// useGas deducts gas from the remaining budget and reports whether there was
+// enough to cover it.
+func (env *VMExecutionEnvironment) useGas(gas uint64) bool {
+	if env.Gas < gas {
+		env.Gas = 0
+		return false
+	}
+	env.Gas -= gas
+	return true
+}
+
+// sstoreGas charges for an SSTORE according to EIP-2200, EIP-2929 and EIP-3529
+// and adjusts the refund counter. original is the slot's value before the
+// transaction started, current its value before this SSTORE.
+func (env *VMExecutionEnvironment) sstoreGas(key, value common.Hash) uint64 {
+	state, address := env.State, env.Context.Address
+
+	var gas uint64
+	if !state.SlotInAccessList(address, key) {
+		state.AddSlotToAccessList(address, key)
+		gas += gasColdSload
+	}
+
+	original := state.GetCommittedState(address, key)
+	current := state.GetState(address, key)
+	zero := common.Hash{}
+
+	if current == value {
+		return gas + gasWarmStorageRead
+	}
+	if original == current {
+		if original == zero {
+			return gas + gasSstoreSet
+		}
+		if value == zero {
+			state.AddRefund(gasSstoreClearsRef)
+		}
+		return gas + gasSstoreReset - gasColdSload
+	}
+
+	// The slot has already been written during this transaction.
+	if original != zero {
+		if current == zero {
+			state.SubRefund(gasSstoreClearsRef)
+		} else if value == zero {
+			state.AddRefund(gasSstoreClearsRef)
+		}
+	}
+	if original == value {
+		if original == zero {
+			state.AddRefund(gasSstoreSet - gasWarmStorageRead)
+		} else {
+			state.AddRefund(gasSstoreReset - gasColdSload - gasWarmStorageRead)
+		}
+	}
+	return gas + gasWarmStorageRead
+}
+
+// sloadGas charges for an SLOAD and marks the slot as accessed.
+func (env *VMExecutionEnvironment) sloadGas(key common.Hash) uint64 {
+	if env.State.SlotInAccessList(env.Context.Address, key) {
+		return gasWarmStorageRead
+	}
+	env.State.AddSlotToAccessList(env.Context.Address, key)
+	return gasColdSload
+}
+
+// accountAccessGas charges the EIP-2929 surcharge for the first access to an
+// account in a transaction. The warm cost is part of the opcode's fixed gas.
+func (env *VMExecutionEnvironment) accountAccessGas(address common.Address) uint64 {
+	if env.State.AddressInAccessList(address) {
+		return 0
+	}
+	env.State.AddAddressToAccessList(address)
+	return gasColdAccountAccess - gasWarmStorageRead
+}
+
+// callGas returns the gas to forward to a sub-call: what was requested, capped
+// at all but one 64th of the gas remaining (EIP-150).
+func (env *VMExecutionEnvironment) callGas(requested *uint256.Int) uint64 {
+	available := env.Gas - env.Gas/64
+	if requested.IsUint64() && requested.Uint64() < available {
+		return requested.Uint64()
+	}
+	return available
+}
@@ -0,0 +1,154 @@
+package contracts
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"smartley-contracts/types"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// TestSstoreGas runs the SSTORE sequences of the EIP-3529 test cases, which
+// write slot 0 two or three times. used is the gas the code uses and refund
+// the refund counter it leaves, as go-ethereum reports them; unlike the EIP's
+// table they include the cold access of the slot (EIP-2929).
+func TestSstoreGas(t *testing.T) {
+	tests := []struct {
+		code     string
+		original byte
+		used     uint64
+		refund   uint64
+	}{
+		{"60006000556000600055", 0, 2312, 0},
+		{"60006000556001600055", 0, 22212, 0},
+		{"60016000556000600055", 0, 22212, 19900},
+		{"60016000556002600055", 0, 22212, 0},
+		{"60016000556001600055", 0, 22212, 0},
+		{"60006000556000600055", 1, 5112, 4800},
+		{"60006000556001600055", 1, 5112, 2800},
+		{"60006000556002600055", 1, 5112, 0},
+		{"60026000556000600055", 1, 5112, 4800},
+		{"60026000556003600055", 1, 5112, 0},
+		{"60026000556001600055", 1, 5112, 2800},
+		{"60026000556002600055", 1, 5112, 0},
+		{"60016000556000600055", 1, 5112, 4800},
+		{"60016000556002600055", 1, 5112, 0},
+		{"60016000556001600055", 1, 2312, 0},
+		{"600160005560006000556001600055", 0, 42218, 19900},
+		{"600060005560016000556000600055", 1, 8018, 7600},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code+"/original_"+string('0'+tt.original), func(t *testing.T) {
+			code, err := hex.DecodeString(tt.code)
+			if err != nil {
+				t.Fatal(err)
+			}
+			account := types.NewStorage()
+			account.SetState(common.Hash{}, common.Hash{31: tt.original})
+			env := newTestEnv(map[common.Address]*types.Storage{testAddress: account})
+
+			if _, err := env.ExecuteInput(code, nil); err != nil {
+				t.Fatalf("execution failed: %v", err)
+			}
+			if refund := env.State.GetRefund(); refund != tt.refund {
+				t.Errorf("refund %d, want %d", refund, tt.refund)
+			}
+
+			// The transaction pays for its intrinsic gas and the code, less
+			// the refund up to a fifth of that (EIP-3529)
+			used := gasTxBase + tt.used
+			refund := tt.refund
+			if refund > used/maxRefundQuotient {
+				refund = used / maxRefundQuotient
+			}
+			if want := used - refund; env.GasUsed != want {
+				t.Errorf("gas used %d, want %d", env.GasUsed, want)
+			}
+		})
+	}
+}
+
+// TestEstimateGas checks that EstimateGas finds the smallest gas limit a call
+// succeeds with, including calls that need more gas than they end up using.
+func TestEstimateGas(t *testing.T) {
+	callee := common.HexToAddress("0x0000000000000000000000000000000000ca11ee")
+	tests := []struct {
+		name     string
+		code     string
+		needMore bool // Whether the limit must exceed the gas used
+	}{
+		{"stop", "00", false},
+		{"sstore", "60015f55", false}, // PUSH1 1, PUSH0, SSTORE
+		// Clearing slot 1 refunds gas, which is only paid out at the end
+		{"sstore_refund", "5f600155", true}, // PUSH0, PUSH1 1, SSTORE
+		// CALL the callee, which stores, with all but 1/64 of the gas left,
+		// and revert if it fails
+		{"call_63_64", "5f5f5f5f5f73" + callee.Hex()[2:] + "5af1" + "15602157005b5f5ffd", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			accounts := map[common.Address]*types.Storage{
+				testAddress: types.NewStorage(),
+				callee:      types.NewStorage(),
+			}
+			accounts[testAddress].SetState(common.BigToHash(common.Big1), common.BigToHash(common.Big1))
+			accounts[callee].SetBytecode(common.FromHex("60015f55"))
+			env := newTestEnv(accounts)
+			env.ABI = []byte(`[{"type":"function","name":"run","stateMutability":"nonpayable","inputs":[],"outputs":[]}]`)
+			env.Bytecode = common.FromHex(tt.code)
+
+			estimate, err := env.EstimateGas("run", nil)
+			if err != nil {
+				t.Fatalf("estimation failed: %v", err)
+			}
+			env.GasLimit = estimate
+			result, err := env.Simulate("run", nil)
+			if err != nil {
+				t.Fatalf("call failed with the estimate %d: %v", estimate, err)
+			}
+			if needMore := estimate > result.GasUsed; needMore != tt.needMore {
+				t.Errorf("estimate %d for %d gas used", estimate, result.GasUsed)
+			}
+			env.GasLimit = estimate - 1
+			if _, err := env.Simulate("run", nil); err == nil {
+				t.Errorf("call succeeded with %d gas, under the estimate", estimate-1)
+			}
+		})
+	}
+}
+
+// TestEstimateGasFailingCall checks that a call failing with any gas limit is
+// reported as failing rather than estimated at the cap.
+func TestEstimateGasFailingCall(t *testing.T) {
+	isRevert := func(err error) bool {
+		var revertErr *RevertError
+		return errors.As(err, &revertErr)
+	}
+	tests := []struct {
+		name  string
+		code  string
+		match func(err error) bool
+	}{
+		{"revert", "5f5ffd", isRevert}, // PUSH0, PUSH0, REVERT
+		{"invalid", "fe", func(err error) bool { return strings.Contains(err.Error(), "INVALID") }},
+		{"out_of_gas", "5b5f56", func(err error) bool { return errors.Is(err, ErrOutOfGas) }}, // JUMPDEST, PUSH0, JUMP
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(nil)
+			env.ABI = []byte(`[{"type":"function","name":"run","stateMutability":"nonpayable","inputs":[],"outputs":[]}]`)
+			env.Bytecode = common.FromHex(tt.code)
+
+			estimate, err := env.EstimateGas("run", nil)
+			if err == nil {
+				t.Fatalf("estimated %d gas for a failing call", estimate)
+			}
+			if !tt.match(err) {
+				t.Errorf("unexpected error %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package contracts
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"smartley-contracts/types"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Words used by the arithmetic tests, in hex.
+const (
+	wordMax    = "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff" // -1
+	wordMinInt = "8000000000000000000000000000000000000000000000000000000000000000" // -2^255
+	wordMaxInt = "7fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff" // 2^255 - 1
+	wordNeg2   = "fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffe"
+	wordNeg3   = "fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffd"
+	wordNeg8   = "fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff8"
+)
+
+// testAddress is the account test programs run as.
+var testAddress = common.HexToAddress("0x00000000000000000000000000000000c0ffee00")
+
+// newTestEnv returns an environment that runs code at testAddress against the
+// given accounts, which may be nil.
+func newTestEnv(accounts map[common.Address]*types.Storage) *VMExecutionEnvironment {
+	if accounts == nil {
+		accounts = make(map[common.Address]*types.Storage)
+	}
+	return &VMExecutionEnvironment{
+		GasLimit: DefaultGasLimit,
+		State:    NewStateDB(accounts),
+		Context: ExecutionContext{
+			Caller:  common.HexToAddress("0x00000000000000000000000000000000000ca11e"),
+			Origin:  common.HexToAddress("0x00000000000000000000000000000000000ca11e"),
+			Address: testAddress,
+		},
+	}
+}
+
+// word returns the 32-byte big-endian encoding of a hex number.
+func word(t *testing.T, s string) []byte {
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		t.Fatalf("invalid test word %q", s)
+	}
+	return n.FillBytes(make([]byte, 32))
+}
+
+// TestArithmeticEdgeCases checks the signed, modular and byte-level opcodes at
+// the edges of their ranges. The expected values are those of go-ethereum's
+// interpreter, which the general state tests are generated with.
+func TestArithmeticEdgeCases(t *testing.T) {
+	tests := []struct {
+		name string
+		op   byte
+		args []string // Operands, the top of the stack first
+		want string
+	}{
+		{"ADD/wraps", 0x01, []string{wordMax, "1"}, "0"},
+		{"ADD/max_plus_max", 0x01, []string{wordMax, wordMax}, wordNeg2},
+		{"MUL/wraps", 0x02, []string{wordMax, wordMax}, "1"},
+		{"MUL/min_by_2", 0x02, []string{wordMinInt, "2"}, "0"},
+		{"SUB/wraps", 0x03, []string{"0", "1"}, wordMax},
+		{"SUB/min_minus_one", 0x03, []string{wordMinInt, "1"}, wordMaxInt},
+		{"EXP/wraps", 0x0a, []string{"2", "100"}, "0"},
+		{"SDIV/min_by_minus_one", 0x05, []string{wordMinInt, wordMax}, wordMinInt},
+		{"SDIV/by_zero", 0x05, []string{"5", "0"}, "0"},
+		{"SDIV/negative_dividend", 0x05, []string{wordNeg8, "3"}, wordNeg2},
+		{"SDIV/negative_divisor", 0x05, []string{"8", wordNeg3}, wordNeg2},
+		{"SDIV/both_negative", 0x05, []string{wordNeg8, wordNeg3}, "2"},
+		{"SDIV/max_by_minus_one", 0x05, []string{wordMaxInt, wordMax}, "8000000000000000000000000000000000000000000000000000000000000001"},
+		{"SMOD/negative_dividend", 0x07, []string{wordNeg8, "3"}, wordNeg2},
+		{"SMOD/negative_divisor", 0x07, []string{"8", wordNeg3}, "2"},
+		{"SMOD/both_negative", 0x07, []string{wordNeg8, wordNeg3}, wordNeg2},
+		{"SMOD/by_zero", 0x07, []string{"5", "0"}, "0"},
+		{"SMOD/min_by_minus_one", 0x07, []string{wordMinInt, wordMax}, "0"},
+		{"SMOD/minus_one_by_min", 0x07, []string{wordMax, wordMinInt}, wordMax},
+		{"SIGNEXTEND/negative_byte", 0x0b, []string{"0", "ff"}, wordMax},
+		{"SIGNEXTEND/positive_byte", 0x0b, []string{"0", "7f"}, "7f"},
+		{"SIGNEXTEND/negative_two_bytes", 0x0b, []string{"1", "8000"}, "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff8000"},
+		{"SIGNEXTEND/clears_high_bits", 0x0b, []string{"0", "1ff"}, wordMax},
+		{"SIGNEXTEND/byte_30", 0x0b, []string{"1e", "8080000000000000000000000000000000000000000000000000000000000000"}, "ff80000000000000000000000000000000000000000000000000000000000000"},
+		{"SIGNEXTEND/byte_31", 0x0b, []string{"1f", wordMinInt}, wordMinInt},
+		{"SIGNEXTEND/byte_32", 0x0b, []string{"20", "ff"}, "ff"},
+		{"SIGNEXTEND/byte_max", 0x0b, []string{wordMax, "ff"}, "ff"},
+		{"BYTE/most_significant", 0x1a, []string{"0", wordMinInt}, "80"},
+		{"BYTE/least_significant", 0x1a, []string{"1f", "1234"}, "34"},
+		{"BYTE/second_least_significant", 0x1a, []string{"1e", "1234"}, "12"},
+		{"BYTE/index_32", 0x1a, []string{"20", wordMax}, "0"},
+		{"BYTE/index_max", 0x1a, []string{wordMax, wordMax}, "0"},
+		{"SHL/by_255", 0x1b, []string{"ff", "1"}, wordMinInt},
+		{"SHL/by_256", 0x1b, []string{"100", wordMax}, "0"},
+		{"SHL/by_max", 0x1b, []string{wordMax, "1"}, "0"},
+		{"SHL/drops_high_bits", 0x1b, []string{"4", wordMax}, "fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff0"},
+		{"SHR/by_256", 0x1c, []string{"100", wordMax}, "0"},
+		{"SHR/by_max", 0x1c, []string{wordMax, wordMax}, "0"},
+		{"SAR/min_by_1", 0x1d, []string{"1", wordMinInt}, "c000000000000000000000000000000000000000000000000000000000000000"},
+		{"SAR/min_by_255", 0x1d, []string{"ff", wordMinInt}, wordMax},
+		{"SAR/min_by_256", 0x1d, []string{"100", wordMinInt}, wordMax},
+		{"SAR/max_by_256", 0x1d, []string{"100", wordMaxInt}, "0"},
+		{"SAR/max_by_254", 0x1d, []string{"fe", wordMaxInt}, "1"},
+		{"SAR/minus_one_by_0", 0x1d, []string{"0", wordMax}, wordMax},
+		{"SAR/minus_one_by_max", 0x1d, []string{wordMax, wordMax}, wordMax},
+		{"SAR/minus_two_by_1", 0x1d, []string{"1", wordNeg2}, wordMax},
+		{"ADDMOD/overflow", 0x08, []string{wordMax, "2", "2"}, "1"},
+		{"ADDMOD/overflow_max", 0x08, []string{wordMax, wordMax, "7"}, "2"},
+		{"ADDMOD/modulus_zero", 0x08, []string{wordMax, "1", "0"}, "0"},
+		{"ADDMOD/modulus_max", 0x08, []string{wordMax, wordMax, wordMax}, "0"},
+		{"ADDMOD/unsigned_operands", 0x08, []string{wordNeg3, wordNeg3, "8"}, "2"},
+		{"MULMOD/overflow", 0x09, []string{wordMax, wordMax, "c"}, "9"},
+		{"MULMOD/modulus_zero", 0x09, []string{wordMax, wordMax, "0"}, "0"},
+		{"MULMOD/modulus_max", 0x09, []string{wordMax, wordMax, wordMax}, "0"},
+		{"MULMOD/min_by_2", 0x09, []string{wordMinInt, "2", wordMax}, "1"},
+		{"MULMOD/unsigned_operands", 0x09, []string{wordNeg3, wordNeg3, "8"}, "1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// PUSH32 each operand, the last first, run the opcode and return
+			// the result
+			var code []byte
+			for i := len(tt.args) - 1; i >= 0; i-- {
+				code = append(append(code, 0x7f), word(t, tt.args[i])...)
+			}
+			code = append(code, tt.op, 0x5f, 0x52, 0x60, 0x20, 0x5f, 0xf3) // op, PUSH0, MSTORE, PUSH1 32, PUSH0, RETURN
+
+			result, err := newTestEnv(nil).ExecuteInput(code, nil)
+			if err != nil {
+				t.Fatalf("execution failed: %v", err)
+			}
+			if got, want := result.([]byte), word(t, tt.want); !bytes.Equal(got, want) {
+				t.Errorf("got %x, want %x", got, want)
+			}
+		})
+	}
+}
+
+// TestStackLimit checks that a frame holds up to 1024 stack items and that an
+// instruction pushing beyond them fails.
+func TestStackLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    []byte
+		wantErr error
+	}{
+		{"full", bytes.Repeat([]byte{0x5f}, 1024), nil},                                            // PUSH0
+		{"push_past_limit", bytes.Repeat([]byte{0x5f}, 1025), types.ErrStackOverflow},              // PUSH0
+		{"dup_past_limit", append(bytes.Repeat([]byte{0x5f}, 1024), 0x80), types.ErrStackOverflow}, // DUP1
+		{"swap_when_full", append(bytes.Repeat([]byte{0x5f}, 1024), 0x90), nil},                    // SWAP1
+		{"add_when_full", append(bytes.Repeat([]byte{0x5f}, 1024), 0x01, 0x5f), nil},               // ADD, PUSH0
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newTestEnv(nil).ExecuteInput(tt.code, nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestJumps checks that JUMP and JUMPI only land on JUMPDEST opcodes, never on
+// a 0x5b byte inside PUSH data or past the end of the code.
+func TestJumps(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		dest uint64 // Destination of the rejected jump, if it fits in a uint64
+		pc   int    // Position of the rejected jump, or -1 if none is
+	}{
+		{"jumpdest", "6003565b", 0, -1},                                      // PUSH1 3, JUMP, JUMPDEST
+		{"jumpi_taken", "6001600657fe5b", 0, -1},                             // PUSH1 1, PUSH1 6, JUMPI, INVALID, JUMPDEST
+		{"jumpi_not_taken", "600060ff57", 0, -1},                             // PUSH1 0, PUSH1 255, JUMPI
+		{"push1_data", "600456605b00", 4, 2},                                 // PUSH1 4, JUMP, PUSH1 0x5b, STOP
+		{"push32_data", "6023567f" + strings.Repeat("00", 31) + "5b", 35, 2}, // PUSH1 35, JUMP, PUSH32 0x...5b
+		{"not_jumpdest", "60035600", 3, 2},                                   // PUSH1 3, JUMP, STOP
+		{"end_of_code", "600356", 3, 2},                                      // PUSH1 3, JUMP
+		{"past_end", "60ff56", 255, 2},                                       // PUSH1 255, JUMP
+		{"jumpi_past_end", "600160ff57", 255, 4},                             // PUSH1 1, PUSH1 255, JUMPI
+		{"beyond_uint64", "680100000000000000035600", 0, 10},                 // PUSH9 2^64+3, JUMP, STOP
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := hex.DecodeString(tt.code)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = newTestEnv(nil).ExecuteInput(code, nil)
+			if tt.pc < 0 {
+				if err != nil {
+					t.Fatalf("execution failed: %v", err)
+				}
+				return
+			}
+			var jumpErr *InvalidJumpError
+			if !errors.As(err, &jumpErr) {
+				t.Fatalf("error %v, want an invalid jump", err)
+			}
+			if jumpErr.PC != tt.pc {
+				t.Errorf("jump at pc %d, want %d", jumpErr.PC, tt.pc)
+			}
+			if tt.dest != 0 && jumpErr.Destination.Uint64() != tt.dest {
+				t.Errorf("destination %s, want %d", jumpErr.Destination.Dec(), tt.dest)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package contracts
+
+import (
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// Log is an event emitted by one of the LOG0-LOG4 opcodes. Event and Args are
+// only set once the log has been decoded against the emitting contract's ABI.
+type Log struct {
+	Address common.Address         `json:"address"`
+	Topics  []common.Hash          `json:"topics"`
+	Data    hexutil.Bytes          `json:"data"`
+	Event   string                 `json:"event,omitempty"`
+	Args    map[string]interface{} `json:"args,omitempty"`
+}
+
+// Decode matches the log's first topic against the events in contractABI and,
+// on a match, fills in Event and Args with the named event fields. Anonymous
+// events and logs from other contracts are left undecoded.
+func (l *Log) Decode(contractABI *abi.ABI) error {
+	if len(l.Topics) == 0 {
+		return nil
+	}
+	event, err := contractABI.EventByID(l.Topics[0])
+	if err != nil {
+		return nil
+	}
+
+	values := make(map[string]interface{}, len(event.Inputs))
+	var indexed abi.Arguments
+	for _, input := range event.Inputs {
+		if input.Indexed {
+			indexed = append(indexed, input)
+		}
+	}
+	if err := abi.ParseTopicsIntoMap(values, indexed, l.Topics[1:]); err != nil {
+		return err
+	}
+	if err := event.Inputs.UnpackIntoMap(values, l.Data); err != nil {
+		return err
+	}
+
+	args := make(map[string]interface{}, len(values))
+	for _, input := range event.Inputs {
+		value := values[input.Name]
+		// Indexed strings, bytes, arrays and structs are only recorded as the
+		// hash of their encoding, which is kept as it is.
+		if input.Indexed && isHashedTopic(input.Type) {
+			args[input.Name] = value
+			continue
+		}
+		args[input.Name] = toJSONValue(input.Type, value)
+	}
+
+	l.Event = event.Name
+	l.Args = args
+	return nil
+}
+
+// isHashedTopic reports whether an indexed event argument of type t is stored as
+// the Keccak-256 hash of its value rather than the value itself.
+func isHashedTopic(t abi.Type) bool {
+	switch t.T {
+	case abi.StringTy, abi.BytesTy, abi.SliceTy, abi.ArrayTy, abi.TupleTy:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,186 @@
+package contracts
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"smartley-contracts/types"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// logCode returns code that writes data to memory from offset 0 and emits it
+// from offset to offset+size with the given topics.
+func logCode(data []byte, offset, size byte, topics []common.Hash) []byte {
+	var code []byte
+	for i := 0; i < len(data); i += 32 {
+		chunk := make([]byte, 32)
+		copy(chunk, data[i:])
+		code = append(append(code, 0x7f), chunk...) // PUSH32 chunk
+		code = append(code, 0x60, byte(i), 0x52)    // PUSH1 i, MSTORE
+	}
+	for i := len(topics) - 1; i >= 0; i-- {
+		code = append(append(code, 0x7f), topics[i].Bytes()...) // PUSH32 topic
+	}
+	return append(code, 0x60, size, 0x60, offset, 0xa0+byte(len(topics))) // PUSH1 size, PUSH1 offset, LOGn
+}
+
+// TestLogTopicsAndData checks that LOG0 to LOG4 record their topics in the
+// order given, the first from the top of the stack, and the slice of memory
+// given as their data.
+func TestLogTopicsAndData(t *testing.T) {
+	data := make([]byte, 64)
+	for i := range data {
+		data[i] = byte(i + 1)
+	}
+	topics := make([]common.Hash, 4)
+	for i := range topics {
+		topics[i] = crypto.Keccak256Hash([]byte{byte(i)})
+	}
+
+	tests := []struct {
+		name   string
+		topics int
+		offset byte
+		size   byte
+	}{
+		{"LOG0/all", 0, 0, 64},
+		{"LOG1/slice", 1, 3, 40},
+		{"LOG2/empty", 2, 10, 0},
+		{"LOG3/past_data", 3, 60, 8}, // Memory expanded by the log reads as zero
+		{"LOG4/one_byte", 4, 63, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(nil)
+			code := logCode(data, tt.offset, tt.size, topics[:tt.topics])
+			if _, err := env.ExecuteInput(code, nil); err != nil {
+				t.Fatalf("execution failed: %v", err)
+			}
+			logs := env.Logs()
+			if len(logs) != 1 {
+				t.Fatalf("%d logs, want 1", len(logs))
+			}
+			l := logs[0]
+			if l.Address != testAddress {
+				t.Errorf("address %s, want %s", l.Address.Hex(), testAddress.Hex())
+			}
+			if len(l.Topics) != tt.topics || (tt.topics > 0 && !reflect.DeepEqual(l.Topics, topics[:tt.topics])) {
+				t.Errorf("topics %v, want %v", l.Topics, topics[:tt.topics])
+			}
+			want := append(append([]byte(nil), data...), make([]byte, 32)...)[tt.offset : int(tt.offset)+int(tt.size)]
+			if !bytes.Equal(l.Data, want) {
+				t.Errorf("data %x, want %x", []byte(l.Data), want)
+			}
+		})
+	}
+}
+
+// TestLogDecode emits events through the VM and checks that their indexed and
+// non-indexed arguments are decoded against the contract's ABI.
+func TestLogDecode(t *testing.T) {
+	const abiJSON = `[{"type":"event","name":"Noted","anonymous":false,"inputs":[
+		{"name":"from","type":"address","indexed":true},
+		{"name":"id","type":"uint256","indexed":true},
+		{"name":"tag","type":"string","indexed":true},
+		{"name":"amount","type":"uint256","indexed":false},
+		{"name":"memo","type":"string","indexed":false}]}]`
+	parsed, err := abi.JSON(strings.NewReader(abiJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := parsed.Events["Noted"]
+	from := common.HexToAddress("0x00000000000000000000000000000000000f4011")
+	data, err := abi.Arguments{event.Inputs[3], event.Inputs[4]}.Pack(common.Big3, "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tagHash := crypto.Keccak256Hash([]byte("urgent"))
+	topics := []common.Hash{event.ID, common.BytesToHash(from.Bytes()), common.BigToHash(common.Big2), tagHash}
+
+	tests := []struct {
+		name      string
+		topics    []common.Hash
+		wantEvent string
+		wantArgs  map[string]interface{}
+	}{
+		{"event", topics, "Noted", map[string]interface{}{
+			"from":   from,
+			"id":     "2",
+			"tag":    tagHash, // Indexed strings are only recorded as their hash
+			"amount": "3",
+			"memo":   "hello",
+		}},
+		{"unknown_event", append([]common.Hash{crypto.Keccak256Hash([]byte("Other()"))}, topics[1:]...), "", nil},
+		{"no_topics", nil, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(nil)
+			env.ABI = []byte(abiJSON)
+			if _, err := env.ExecuteInput(logCode(data, 0, byte(len(data)), tt.topics), nil); err != nil {
+				t.Fatalf("execution failed: %v", err)
+			}
+			l := env.Logs()[0]
+			if l.Event != tt.wantEvent {
+				t.Errorf("event %q, want %q", l.Event, tt.wantEvent)
+			}
+			if !reflect.DeepEqual(l.Args, tt.wantArgs) {
+				t.Errorf("args %#v, want %#v", l.Args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+// TestLogsDroppedOnRevert checks that the logs of a frame that reverts or
+// fails are dropped with the rest of its changes, while those of its caller
+// and of frames that succeed are kept in order.
+func TestLogsDroppedOnRevert(t *testing.T) {
+	// log1 emits a LOG1 with topic n and no data
+	log1 := func(n byte) string { return "60" + common.Bytes2Hex([]byte{n}) + "5f5fa1" }
+	// call CALLs address, ignoring the result
+	call := func(address common.Address) string { return "5f5f5f5f5f73" + address.Hex()[2:] + "5af150" }
+
+	reverting := common.HexToAddress("0x00000000000000000000000000000000000000a1")
+	failing := common.HexToAddress("0x00000000000000000000000000000000000000a2")
+	succeeding := common.HexToAddress("0x00000000000000000000000000000000000000a3")
+	accounts := map[common.Address]*types.Storage{
+		reverting:  accountWith(0, common.FromHex(log1(3)+"5f5ffd")), // REVERT
+		failing:    accountWith(0, common.FromHex(log1(4)+"fe")),     // INVALID
+		succeeding: accountWith(0, common.FromHex(log1(5))),
+	}
+	code := common.FromHex(log1(1) + call(reverting) + call(failing) + call(succeeding) + log1(2))
+
+	env := newTestEnv(accounts)
+	if _, err := env.ExecuteInput(code, nil); err != nil {
+		t.Fatalf("execution failed: %v", err)
+	}
+	want := []struct {
+		address common.Address
+		topic   byte
+	}{{testAddress, 1}, {succeeding, 5}, {testAddress, 2}}
+	logs := env.Logs()
+	if len(logs) != len(want) {
+		t.Fatalf("%d logs, want %d", len(logs), len(want))
+	}
+	for i, w := range want {
+		if logs[i].Address != w.address || logs[i].Topics[0] != common.BytesToHash([]byte{w.topic}) {
+			t.Errorf("log %d from %s with topic %s, want %s with topic %d", i, logs[i].Address.Hex(), logs[i].Topics[0].Hex(), w.address.Hex(), w.topic)
+		}
+	}
+
+	// A call that reverts itself keeps none of its logs
+	for _, ending := range []string{"5f5ffd", "fe"} {
+		env := newTestEnv(nil)
+		if _, err := env.ExecuteInput(common.FromHex(log1(1)+ending), nil); err == nil {
+			t.Fatalf("code ending in %s succeeded", ending)
+		}
+		if logs := env.Logs(); len(logs) != 0 {
+			t.Errorf("code ending in %s kept %d logs", ending, len(logs))
+		}
+	}
+}
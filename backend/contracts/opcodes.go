@@ -0,0 +1,116 @@
+package contracts
+
+import "fmt"
+
+// operation describes an opcode's fixed gas cost and how it uses the stack.
+// ExecuteBytecode checks these requirements before running each instruction so
+// that stack underflow and overflow surface as errors rather than corrupting
+// the frame. Dynamic costs are charged by the instruction itself.
+type operation struct {
+	name   string
+	gas    uint64 // fixed gas charged before the instruction runs
+	pops   int    // words that must be on the stack
+	pushes int    // words left on the stack in place of the popped ones
+}
+
+var operations = [256]*operation{
+	0x00: {name: "STOP", gas: gasZero},
+	0x01: {name: "ADD", gas: gasFastest, pops: 2, pushes: 1},
+	0x02: {name: "MUL", gas: gasFast, pops: 2, pushes: 1},
+	0x03: {name: "SUB", gas: gasFastest, pops: 2, pushes: 1},
+	0x04: {name: "DIV", gas: gasFast, pops: 2, pushes: 1},
+	0x05: {name: "SDIV", gas: gasFast, pops: 2, pushes: 1},
+	0x06: {name: "MOD", gas: gasFast, pops: 2, pushes: 1},
+	0x07: {name: "SMOD", gas: gasFast, pops: 2, pushes: 1},
+	0x08: {name: "ADDMOD", gas: gasMid, pops: 3, pushes: 1},
+	0x09: {name: "MULMOD", gas: gasMid, pops: 3, pushes: 1},
+	0x0a: {name: "EXP", gas: gasSlow, pops: 2, pushes: 1},
+	0x0b: {name: "SIGNEXTEND", gas: gasFast, pops: 2, pushes: 1},
+	0x10: {name: "LT", gas: gasFastest, pops: 2, pushes: 1},
+	0x11: {name: "GT", gas: gasFastest, pops: 2, pushes: 1},
+	0x12: {name: "SLT", gas: gasFastest, pops: 2, pushes: 1},
+	0x13: {name: "SGT", gas: gasFastest, pops: 2, pushes: 1},
+	0x14: {name: "EQ", gas: gasFastest, pops: 2, pushes: 1},
+	0x15: {name: "ISZERO", gas: gasFastest, pops: 1, pushes: 1},
+	0x16: {name: "AND", gas: gasFastest, pops: 2, pushes: 1},
+	0x17: {name: "OR", gas: gasFastest, pops: 2, pushes: 1},
+	0x18: {name: "XOR", gas: gasFastest, pops: 2, pushes: 1},
+	0x19: {name: "NOT", gas: gasFastest, pops: 1, pushes: 1},
+	0x1a: {name: "BYTE", gas: gasFastest, pops: 2, pushes: 1},
+	0x1b: {name: "SHL", gas: gasFastest, pops: 2, pushes: 1},
+	0x1c: {name: "SHR", gas: gasFastest, pops: 2, pushes: 1},
+	0x1d: {name: "SAR", gas: gasFastest, pops: 2, pushes: 1},
+	0x20: {name: "KECCAK256", gas: gasKeccak256, pops: 2, pushes: 1},
+	0x30: {name: "ADDRESS", gas: gasQuick, pushes: 1},
+	0x31: {name: "BALANCE", gas: gasWarmStorageRead, pops: 1, pushes: 1},
+	0x32: {name: "ORIGIN", gas: gasQuick, pushes: 1},
+	0x33: {name: "CALLER", gas: gasQuick, pushes: 1},
+	0x34: {name: "CALLVALUE", gas: gasQuick, pushes: 1},
+	0x35: {name: "CALLDATALOAD", gas: gasFastest, pops: 1, pushes: 1},
+	0x36: {name: "CALLDATASIZE", gas: gasQuick, pushes: 1},
+	0x37: {name: "CALLDATACOPY", gas: gasFastest, pops: 3},
+	0x38: {name: "CODESIZE", gas: gasQuick, pushes: 1},
+	0x39: {name: "CODECOPY", gas: gasFastest, pops: 3},
+	0x3a: {name: "GASPRICE", gas: gasQuick, pushes: 1},
+	0x3b: {name: "EXTCODESIZE", gas: gasWarmStorageRead, pops: 1, pushes: 1},
+	0x3c: {name: "EXTCODECOPY", gas: gasWarmStorageRead, pops: 4},
+	0x3d: {name: "RETURNDATASIZE", gas: gasQuick, pushes: 1},
+	0x3e: {name: "RETURNDATACOPY", gas: gasFastest, pops: 3},
+	0x3f: {name: "EXTCODEHASH", gas: gasWarmStorageRead, pops: 1, pushes: 1},
+	0x40: {name: "BLOCKHASH", gas: gasExtStep, pops: 1, pushes: 1},
+	0x41: {name: "COINBASE", gas: gasQuick, pushes: 1},
+	0x42: {name: "TIMESTAMP", gas: gasQuick, pushes: 1},
+	0x43: {name: "NUMBER", gas: gasQuick, pushes: 1},
+	0x44: {name: "DIFFICULTY", gas: gasQuick, pushes: 1},
+	0x45: {name: "GASLIMIT", gas: gasQuick, pushes: 1},
+	0x46: {name: "CHAINID", gas: gasQuick, pushes: 1},
+	0x47: {name: "SELFBALANCE", gas: gasFast, pushes: 1},
+	0x48: {name: "BASEFEE", gas: gasQuick, pushes: 1},
+	0x50: {name: "POP", gas: gasQuick, pops: 1},
+	0x51: {name: "MLOAD", gas: gasFastest, pops: 1, pushes: 1},
+	0x52: {name: "MSTORE", gas: gasFastest, pops: 2},
+	0x53: {name: "MSTORE8", gas: gasFastest, pops: 2},
+	0x54: {name: "SLOAD", gas: gasZero, pops: 1, pushes: 1},
+	0x55: {name: "SSTORE", gas: gasZero, pops: 2},
+	0x56: {name: "JUMP", gas: gasMid, pops: 1},
+	0x57: {name: "JUMPI", gas: gasSlow, pops: 2},
+	0x58: {name: "PC", gas: gasQuick, pushes: 1},
+	0x59: {name: "MSIZE", gas: gasQuick, pushes: 1},
+	0x5a: {name: "GAS", gas: gasQuick, pushes: 1},
+	0x5b: {name: "JUMPDEST", gas: gasJumpDst},
+	0x5f: {name: "PUSH0", gas: gasQuick, pushes: 1},
+	0xa0: {name: "LOG0", gas: gasLog, pops: 2},
+	0xa1: {name: "LOG1", gas: gasLog + gasLogTopic, pops: 3},
+	0xa2: {name: "LOG2", gas: gasLog + 2*gasLogTopic, pops: 4},
+	0xa3: {name: "LOG3", gas: gasLog + 3*gasLogTopic, pops: 5},
+	0xa4: {name: "LOG4", gas: gasLog + 4*gasLogTopic, pops: 6},
+	0xf0: {name: "CREATE", gas: gasCreate, pops: 3, pushes: 1},
+	0xf1: {name: "CALL", gas: gasWarmStorageRead, pops: 7, pushes: 1},
+	0xf2: {name: "CALLCODE", gas: gasWarmStorageRead, pops: 7, pushes: 1},
+	0xf3: {name: "RETURN", gas: gasZero, pops: 2},
+	0xf4: {name: "DELEGATECALL", gas: gasWarmStorageRead, pops: 6, pushes: 1},
+	0xf5: {name: "CREATE2", gas: gasCreate, pops: 4, pushes: 1},
+	0xfa: {name: "STATICCALL", gas: gasWarmStorageRead, pops: 6, pushes: 1},
+	0xfd: {name: "REVERT", gas: gasZero, pops: 2},
+	0xfe: {name: "INVALID", gas: gasZero},
+}
+
+func init() {
+	for n := 1; n <= 32; n++ {
+		operations[0x5f+n] = &operation{name: fmt.Sprintf("PUSH%d", n), gas: gasFastest, pushes: 1}
+	}
+	for n := 1; n <= 16; n++ {
+		// DUPn needs n words and leaves n+1; SWAPn needs n+1 words and leaves them all.
+		operations[0x7f+n] = &operation{name: fmt.Sprintf("DUP%d", n), gas: gasFastest, pops: n, pushes: n + 1}
+		operations[0x8f+n] = &operation{name: fmt.Sprintf("SWAP%d", n), gas: gasFastest, pops: n + 1, pushes: n + 1}
+	}
+}
+
+// OpName returns the mnemonic for op, or a hex placeholder for opcodes this VM
+// does not implement.
+func OpName(op byte) string {
+	if info := operations[op]; info != nil {
+		return info.name
+	}
+	return fmt.Sprintf("opcode 0x%02x", op)
+}
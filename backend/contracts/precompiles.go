@@ -0,0 +1,368 @@
+package contracts
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/blake2b"
+	"github.com/ethereum/go-ethereum/crypto/bn256"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// precompile is a contract implemented natively rather than in EVM code. Calls
+// to its address run it directly; requiredGas is charged before run.
+type precompile interface {
+	requiredGas(input []byte) uint64
+	run(input []byte) ([]byte, error)
+}
+
+// precompiles are the standard Ethereum precompiled contracts, with the gas
+// schedule in force since the Berlin fork.
+var precompiles = map[common.Address]precompile{
+	common.BytesToAddress([]byte{0x01}): ecrecover{},
+	common.BytesToAddress([]byte{0x02}): sha256Hash{},
+	common.BytesToAddress([]byte{0x03}): ripemd160Hash{},
+	common.BytesToAddress([]byte{0x04}): identity{},
+	common.BytesToAddress([]byte{0x05}): modExp{},
+	common.BytesToAddress([]byte{0x06}): bn256Add{},
+	common.BytesToAddress([]byte{0x07}): bn256ScalarMul{},
+	common.BytesToAddress([]byte{0x08}): bn256Pairing{},
+	common.BytesToAddress([]byte{0x09}): blake2F{},
+}
+
+// Precompile gas costs.
+const (
+	gasEcrecover         uint64 = 3000
+	gasSha256Base        uint64 = 60
+	gasSha256Word        uint64 = 12
+	gasRipemd160Base     uint64 = 600
+	gasRipemd160Word     uint64 = 120
+	gasIdentityBase      uint64 = 15
+	gasIdentityWord      uint64 = 3
+	gasModExpMin         uint64 = 200
+	gasBn256Add          uint64 = 150
+	gasBn256ScalarMul    uint64 = 6000
+	gasBn256PairingBase  uint64 = 45000
+	gasBn256PairingPoint uint64 = 34000
+)
+
+const (
+	bn256PairingPointInputBytes = 192 // a G1 point (64 bytes) and a G2 point (128 bytes)
+	blake2FInputLength          = 213
+)
+
+var (
+	errBadPairingInput         = errors.New("bad elliptic curve pairing size")
+	errBlake2FInvalidInputSize = errors.New("invalid input length")
+	errBlake2FInvalidFinalFlag = errors.New("invalid final flag")
+
+	true32Byte  = common.LeftPadBytes([]byte{1}, 32)
+	false32Byte = make([]byte, 32)
+)
+
+// runPrecompile charges a precompile's gas from the gas given to the call and
+// runs it. Like any other failed frame, a precompile that runs out of gas or
+// rejects its input consumes all the gas.
+func runPrecompile(p precompile, input []byte, gas uint64) ([]byte, uint64, error) {
+	cost := p.requiredGas(input)
+	if gas < cost {
+		return nil, 0, ErrOutOfGas
+	}
+	output, err := p.run(input)
+	if err != nil {
+		return nil, 0, err
+	}
+	return output, gas - cost, nil
+}
+
+// ecrecover (0x01) returns the address that signed a message hash, or nothing
+// if the signature is invalid.
+type ecrecover struct{}
+
+func (ecrecover) requiredGas(input []byte) uint64 {
+	return gasEcrecover
+}
+
+func (ecrecover) run(input []byte) ([]byte, error) {
+	input = getData(input, 0, 128)
+	r := new(big.Int).SetBytes(input[64:96])
+	s := new(big.Int).SetBytes(input[96:128])
+	v := input[63] - 27
+
+	// v is a 32-byte word whose upper bytes must be zero
+	if new(big.Int).SetBytes(input[32:63]).Sign() != 0 || !crypto.ValidateSignatureValues(v, r, s, false) {
+		return nil, nil
+	}
+	sig := make([]byte, 65)
+	copy(sig, input[64:128])
+	sig[64] = v
+	pubKey, err := crypto.Ecrecover(input[:32], sig)
+	if err != nil {
+		return nil, nil
+	}
+	// The first byte of the public key is the 0x04 uncompressed point prefix
+	return common.LeftPadBytes(crypto.Keccak256(pubKey[1:])[12:], 32), nil
+}
+
+// sha256Hash (0x02) returns the SHA-256 digest of its input.
+type sha256Hash struct{}
+
+func (sha256Hash) requiredGas(input []byte) uint64 {
+	return gasSha256Base + gasSha256Word*toWordSize(uint64(len(input)))
+}
+
+func (sha256Hash) run(input []byte) ([]byte, error) {
+	digest := sha256.Sum256(input)
+	return digest[:], nil
+}
+
+// ripemd160Hash (0x03) returns the RIPEMD-160 digest of its input, left-padded
+// to 32 bytes.
+type ripemd160Hash struct{}
+
+func (ripemd160Hash) requiredGas(input []byte) uint64 {
+	return gasRipemd160Base + gasRipemd160Word*toWordSize(uint64(len(input)))
+}
+
+func (ripemd160Hash) run(input []byte) ([]byte, error) {
+	hasher := ripemd160.New()
+	hasher.Write(input)
+	return common.LeftPadBytes(hasher.Sum(nil), 32), nil
+}
+
+// identity (0x04) returns its input unchanged.
+type identity struct{}
+
+func (identity) requiredGas(input []byte) uint64 {
+	return gasIdentityBase + gasIdentityWord*toWordSize(uint64(len(input)))
+}
+
+func (identity) run(input []byte) ([]byte, error) {
+	return common.CopyBytes(input), nil
+}
+
+// modExp (0x05) computes base**exp % mod for arbitrary-length operands (EIP-198),
+// priced according to EIP-2565.
+type modExp struct{}
+
+// modExpLengths reads the three operand lengths that head the input and
+// returns them together with the operands that follow.
+func modExpLengths(input []byte) (baseLen, expLen, modLen *big.Int, operands []byte) {
+	baseLen = new(big.Int).SetBytes(getData(input, 0, 32))
+	expLen = new(big.Int).SetBytes(getData(input, 32, 32))
+	modLen = new(big.Int).SetBytes(getData(input, 64, 32))
+	if len(input) > 96 {
+		operands = input[96:]
+	}
+	return baseLen, expLen, modLen, operands
+}
+
+func (modExp) requiredGas(input []byte) uint64 {
+	baseLen, expLen, modLen, operands := modExpLengths(input)
+
+	// Only the first 32 bytes of the exponent affect the price
+	expHead := new(big.Int)
+	if big.NewInt(int64(len(operands))).Cmp(baseLen) > 0 {
+		headLen := uint64(32)
+		if expLen.Cmp(big.NewInt(32)) <= 0 {
+			headLen = expLen.Uint64()
+		}
+		expHead.SetBytes(getData(operands, baseLen.Uint64(), headLen))
+	}
+	adjExpLen := new(big.Int)
+	if expLen.Cmp(big.NewInt(32)) > 0 {
+		adjExpLen.Sub(expLen, big.NewInt(32))
+		adjExpLen.Mul(adjExpLen, big.NewInt(8))
+	}
+	if bitLen := expHead.BitLen(); bitLen > 0 {
+		adjExpLen.Add(adjExpLen, big.NewInt(int64(bitLen-1)))
+	}
+	if adjExpLen.Sign() == 0 {
+		adjExpLen.SetInt64(1)
+	}
+
+	// ceil(max(baseLen, modLen) / 8)^2 * adjExpLen / 3
+	gas := new(big.Int).Set(baseLen)
+	if modLen.Cmp(gas) > 0 {
+		gas.Set(modLen)
+	}
+	gas.Add(gas, big.NewInt(7))
+	gas.Div(gas, big.NewInt(8))
+	gas.Mul(gas, gas)
+	gas.Mul(gas, adjExpLen)
+	gas.Div(gas, big.NewInt(3))
+	if !gas.IsUint64() {
+		return math.MaxUint64
+	}
+	if gas.Uint64() < gasModExpMin {
+		return gasModExpMin
+	}
+	return gas.Uint64()
+}
+
+func (modExp) run(input []byte) ([]byte, error) {
+	baseLen, expLen, modLen, operands := modExpLengths(input)
+	if baseLen.Sign() == 0 && modLen.Sign() == 0 {
+		return []byte{}, nil
+	}
+	// requiredGas has priced any length that does not fit in 64 bits out of reach
+	base64, exp64, mod64 := baseLen.Uint64(), expLen.Uint64(), modLen.Uint64()
+	base := new(big.Int).SetBytes(getData(operands, 0, base64))
+	exp := new(big.Int).SetBytes(getData(operands, base64, exp64))
+	mod := new(big.Int).SetBytes(getData(operands, base64+exp64, mod64))
+
+	var result []byte
+	switch {
+	case mod.Sign() == 0:
+		// Modulo 0 is undefined and yields zero
+	case base.BitLen() == 1:
+		// A base of 1 needs no exponentiation
+		result = base.Mod(base, mod).Bytes()
+	default:
+		result = base.Exp(base, exp, mod).Bytes()
+	}
+	return common.LeftPadBytes(result, int(mod64)), nil
+}
+
+// bn256Add (0x06) adds two points on the alt_bn128 curve (EIP-196).
+type bn256Add struct{}
+
+func (bn256Add) requiredGas(input []byte) uint64 {
+	return gasBn256Add
+}
+
+func (bn256Add) run(input []byte) ([]byte, error) {
+	x, err := newCurvePoint(getData(input, 0, 64))
+	if err != nil {
+		return nil, err
+	}
+	y, err := newCurvePoint(getData(input, 64, 64))
+	if err != nil {
+		return nil, err
+	}
+	res := new(bn256.G1)
+	res.Add(x, y)
+	return res.Marshal(), nil
+}
+
+// bn256ScalarMul (0x07) multiplies a point on the alt_bn128 curve by a scalar
+// (EIP-196).
+type bn256ScalarMul struct{}
+
+func (bn256ScalarMul) requiredGas(input []byte) uint64 {
+	return gasBn256ScalarMul
+}
+
+func (bn256ScalarMul) run(input []byte) ([]byte, error) {
+	p, err := newCurvePoint(getData(input, 0, 64))
+	if err != nil {
+		return nil, err
+	}
+	res := new(bn256.G1)
+	res.ScalarMult(p, new(big.Int).SetBytes(getData(input, 64, 32)))
+	return res.Marshal(), nil
+}
+
+// bn256Pairing (0x08) runs the alt_bn128 pairing check over a list of point
+// pairs (EIP-197).
+type bn256Pairing struct{}
+
+func (bn256Pairing) requiredGas(input []byte) uint64 {
+	return gasBn256PairingBase + uint64(len(input)/bn256PairingPointInputBytes)*gasBn256PairingPoint
+}
+
+func (bn256Pairing) run(input []byte) ([]byte, error) {
+	if len(input)%bn256PairingPointInputBytes != 0 {
+		return nil, errBadPairingInput
+	}
+	var (
+		cs []*bn256.G1
+		ts []*bn256.G2
+	)
+	for i := 0; i < len(input); i += bn256PairingPointInputBytes {
+		c, err := newCurvePoint(input[i : i+64])
+		if err != nil {
+			return nil, err
+		}
+		t, err := newTwistPoint(input[i+64 : i+bn256PairingPointInputBytes])
+		if err != nil {
+			return nil, err
+		}
+		cs = append(cs, c)
+		ts = append(ts, t)
+	}
+	if bn256.PairingCheck(cs, ts) {
+		return true32Byte, nil
+	}
+	return false32Byte, nil
+}
+
+// newCurvePoint unmarshals a G1 point, rejecting points not on the curve.
+func newCurvePoint(blob []byte) (*bn256.G1, error) {
+	p := new(bn256.G1)
+	if _, err := p.Unmarshal(blob); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// newTwistPoint unmarshals a G2 point, rejecting points not on the twist.
+func newTwistPoint(blob []byte) (*bn256.G2, error) {
+	p := new(bn256.G2)
+	if _, err := p.Unmarshal(blob); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// blake2F (0x09) runs the BLAKE2b compression function F (EIP-152). The input
+// is rounds (4 bytes), h (64), m (128), t (16) and the final block flag (1).
+type blake2F struct{}
+
+func (blake2F) requiredGas(input []byte) uint64 {
+	if len(input) != blake2FInputLength {
+		// run rejects the input without doing any work
+		return 0
+	}
+	return uint64(binary.BigEndian.Uint32(input[0:4]))
+}
+
+func (blake2F) run(input []byte) ([]byte, error) {
+	if len(input) != blake2FInputLength {
+		return nil, errBlake2FInvalidInputSize
+	}
+	if input[212] > 1 {
+		return nil, errBlake2FInvalidFinalFlag
+	}
+
+	var (
+		rounds = binary.BigEndian.Uint32(input[0:4])
+		final  = input[212] == 1
+		h      [8]uint64
+		m      [16]uint64
+		t      [2]uint64
+	)
+	for i := range h {
+		offset := 4 + i*8
+		h[i] = binary.LittleEndian.Uint64(input[offset : offset+8])
+	}
+	for i := range m {
+		offset := 68 + i*8
+		m[i] = binary.LittleEndian.Uint64(input[offset : offset+8])
+	}
+	t[0] = binary.LittleEndian.Uint64(input[196:204])
+	t[1] = binary.LittleEndian.Uint64(input[204:212])
+
+	blake2b.F(&h, m, t, final, rounds)
+
+	output := make([]byte, 64)
+	for i := range h {
+		binary.LittleEndian.PutUint64(output[i*8:i*8+8], h[i])
+	}
+	return output, nil
+}
@@ -0,0 +1,276 @@
+package contracts
+
+import (
+	"smartley-contracts/types"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/uint256"
+)
+
+// StateDB is the world state seen by one transaction. It reads accounts from a
+// committed map, such as Blockchain.State, but writes to private working copies
+// so that nothing reaches the committed map until Commit is called. Every change
+// is journaled so that a failed sub-call can be rolled back on its own with
+// Snapshot and RevertToSnapshot.
+type StateDB struct {
+	committed map[common.Address]*types.Storage
+	dirty     map[common.Address]*types.Storage
+	journal   []func()
+
+	// Transaction-scoped bookkeeping, rolled back together with state changes
+	accessedAddresses map[common.Address]struct{}
+	accessedSlots     map[common.Address]map[common.Hash]struct{}
+	refund            uint64
+	logs              []*Log
+}
+
+// NewStateDB creates a transaction view over the committed accounts.
+func NewStateDB(committed map[common.Address]*types.Storage) *StateDB {
+	if committed == nil {
+		committed = make(map[common.Address]*types.Storage)
+	}
+	return &StateDB{
+		committed:         committed,
+		dirty:             make(map[common.Address]*types.Storage),
+		accessedAddresses: make(map[common.Address]struct{}),
+		accessedSlots:     make(map[common.Address]map[common.Hash]struct{}),
+	}
+}
+
+// GetStorage returns the working copy of an account, or nil if it does not exist.
+func (s *StateDB) GetStorage(address common.Address) *types.Storage {
+	if storage, ok := s.dirty[address]; ok {
+		return storage
+	}
+	committed, ok := s.committed[address]
+	if !ok {
+		return nil
+	}
+	storage := committed.Copy()
+	s.dirty[address] = storage
+	return storage
+}
+
+// Exist reports whether an account exists at address.
+func (s *StateDB) Exist(address common.Address) bool {
+	return s.GetStorage(address) != nil
+}
+
+// GetCode returns the code deployed at address.
+func (s *StateDB) GetCode(address common.Address) []byte {
+	if storage := s.GetStorage(address); storage != nil {
+		return storage.GetBytecode()
+	}
+	return nil
+}
+
+// Empty reports whether the account at address is empty as defined by EIP-161:
+// no code, a zero nonce and a zero balance. Accounts that do not exist are empty.
+func (s *StateDB) Empty(address common.Address) bool {
+	storage := s.GetStorage(address)
+	return storage == nil || (storage.GetNonce() == 0 && storage.GetBalance().IsZero() && len(storage.GetBytecode()) == 0)
+}
+
+// GetBalance returns the balance of the account at address.
+func (s *StateDB) GetBalance(address common.Address) *uint256.Int {
+	if storage := s.GetStorage(address); storage != nil {
+		return storage.GetBalance()
+	}
+	return new(uint256.Int)
+}
+
+// AddBalance credits amount to an account, creating the account if necessary.
+func (s *StateDB) AddBalance(address common.Address, amount *uint256.Int) {
+	storage := s.getOrNewStorage(address)
+	prev := storage.GetBalance()
+	s.journal = append(s.journal, func() { storage.SetBalance(prev) })
+	storage.SetBalance(new(uint256.Int).Add(prev, amount))
+}
+
+// SubBalance debits amount from an account. Callers check the balance first.
+func (s *StateDB) SubBalance(address common.Address, amount *uint256.Int) {
+	storage := s.getOrNewStorage(address)
+	prev := storage.GetBalance()
+	s.journal = append(s.journal, func() { storage.SetBalance(prev) })
+	storage.SetBalance(new(uint256.Int).Sub(prev, amount))
+}
+
+// CanTransfer reports whether the account at from holds at least amount.
+func (s *StateDB) CanTransfer(from common.Address, amount *uint256.Int) bool {
+	return !s.GetBalance(from).Lt(amount)
+}
+
+// Transfer moves amount from one account to another. Transferring zero leaves
+// both accounts untouched, so it never creates the recipient.
+func (s *StateDB) Transfer(from, to common.Address, amount *uint256.Int) {
+	if amount.IsZero() {
+		return
+	}
+	s.SubBalance(from, amount)
+	s.AddBalance(to, amount)
+}
+
+// GetNonce returns the nonce of the account at address.
+func (s *StateDB) GetNonce(address common.Address) uint64 {
+	if storage := s.GetStorage(address); storage != nil {
+		return storage.GetNonce()
+	}
+	return 0
+}
+
+// SetNonce sets the nonce of an account, creating the account if necessary.
+func (s *StateDB) SetNonce(address common.Address, nonce uint64) {
+	storage := s.getOrNewStorage(address)
+	prev := storage.GetNonce()
+	s.journal = append(s.journal, func() { storage.SetNonce(prev) })
+	storage.SetNonce(nonce)
+}
+
+// SetCode sets the code of an account, creating the account if necessary.
+func (s *StateDB) SetCode(address common.Address, code []byte) {
+	storage := s.getOrNewStorage(address)
+	prev := storage.GetBytecode()
+	s.journal = append(s.journal, func() { storage.SetBytecode(prev) })
+	storage.SetBytecode(code)
+}
+
+// CreateAccount replaces whatever is at address with a new, empty account. Any
+// balance already sent to the address is carried over.
+func (s *StateDB) CreateAccount(address common.Address) {
+	storage := types.NewStorage()
+	storage.SetBalance(s.GetBalance(address))
+	prev, existed := s.dirty[address]
+	s.dirty[address] = storage
+	s.journal = append(s.journal, func() {
+		if existed {
+			s.dirty[address] = prev
+		} else {
+			delete(s.dirty, address)
+		}
+	})
+}
+
+// GetState returns the current value of a storage slot.
+func (s *StateDB) GetState(address common.Address, key common.Hash) common.Hash {
+	if storage := s.GetStorage(address); storage != nil {
+		return storage.GetState(key)
+	}
+	return common.Hash{}
+}
+
+// GetCommittedState returns the value a storage slot had when the transaction started.
+func (s *StateDB) GetCommittedState(address common.Address, key common.Hash) common.Hash {
+	if storage, ok := s.committed[address]; ok {
+		return storage.GetState(key)
+	}
+	return common.Hash{}
+}
+
+// SetState writes a storage slot, creating the account if necessary.
+func (s *StateDB) SetState(address common.Address, key, value common.Hash) {
+	storage := s.getOrNewStorage(address)
+	prev := storage.GetState(key)
+	s.journal = append(s.journal, func() { storage.SetState(key, prev) })
+	storage.SetState(key, value)
+}
+
+// getOrNewStorage returns the working copy of an account, creating an empty
+// account if there is none.
+func (s *StateDB) getOrNewStorage(address common.Address) *types.Storage {
+	if storage := s.GetStorage(address); storage != nil {
+		return storage
+	}
+	storage := types.NewStorage()
+	s.dirty[address] = storage
+	s.journal = append(s.journal, func() { delete(s.dirty, address) })
+	return storage
+}
+
+// AddressInAccessList reports whether address has been accessed by the transaction.
+func (s *StateDB) AddressInAccessList(address common.Address) bool {
+	_, ok := s.accessedAddresses[address]
+	return ok
+}
+
+// AddAddressToAccessList marks address as accessed (EIP-2929).
+func (s *StateDB) AddAddressToAccessList(address common.Address) {
+	if s.AddressInAccessList(address) {
+		return
+	}
+	s.accessedAddresses[address] = struct{}{}
+	s.journal = append(s.journal, func() { delete(s.accessedAddresses, address) })
+}
+
+// SlotInAccessList reports whether a storage slot has been accessed by the transaction.
+func (s *StateDB) SlotInAccessList(address common.Address, key common.Hash) bool {
+	_, ok := s.accessedSlots[address][key]
+	return ok
+}
+
+// AddSlotToAccessList marks a storage slot as accessed (EIP-2929).
+func (s *StateDB) AddSlotToAccessList(address common.Address, key common.Hash) {
+	if s.SlotInAccessList(address, key) {
+		return
+	}
+	slots, ok := s.accessedSlots[address]
+	if !ok {
+		slots = make(map[common.Hash]struct{})
+		s.accessedSlots[address] = slots
+	}
+	slots[key] = struct{}{}
+	s.journal = append(s.journal, func() { delete(slots, key) })
+}
+
+// AddRefund increases the gas refund counter.
+func (s *StateDB) AddRefund(gas uint64) {
+	prev := s.refund
+	s.journal = append(s.journal, func() { s.refund = prev })
+	s.refund += gas
+}
+
+// SubRefund decreases the gas refund counter.
+func (s *StateDB) SubRefund(gas uint64) {
+	prev := s.refund
+	s.journal = append(s.journal, func() { s.refund = prev })
+	s.refund -= gas
+}
+
+// GetRefund returns the gas refund counter.
+func (s *StateDB) GetRefund() uint64 {
+	return s.refund
+}
+
+// AddLog records a log emitted by the transaction.
+func (s *StateDB) AddLog(l *Log) {
+	n := len(s.logs)
+	s.journal = append(s.journal, func() { s.logs = s.logs[:n] })
+	s.logs = append(s.logs, l)
+}
+
+// Logs returns the logs emitted by the transaction so far.
+func (s *StateDB) Logs() []*Log {
+	return s.logs
+}
+
+// Snapshot returns an identifier for the current state, for use with RevertToSnapshot.
+func (s *StateDB) Snapshot() int {
+	return len(s.journal)
+}
+
+// RevertToSnapshot undoes every change made since the snapshot was taken.
+func (s *StateDB) RevertToSnapshot(id int) {
+	for i := len(s.journal) - 1; i >= id; i-- {
+		s.journal[i]()
+	}
+	s.journal = s.journal[:id]
+}
+
+// Commit writes every account touched by the transaction back to the committed
+// map and clears the journal, so that earlier snapshots can no longer be reverted.
+func (s *StateDB) Commit() {
+	for address, storage := range s.dirty {
+		s.committed[address] = storage
+	}
+	s.dirty = make(map[common.Address]*types.Storage)
+	s.journal = nil
+}
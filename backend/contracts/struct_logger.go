@@ -0,0 +1,160 @@
+package contracts
+
+import (
+	"encoding/hex"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/holiman/uint256"
+)
+
+// LogConfig selects what StructLogger records with each step. The zero value
+// records the stack and storage but not memory or return data, as geth does.
+type LogConfig struct {
+	EnableMemory     bool `json:"enableMemory"`
+	DisableStack     bool `json:"disableStack"`
+	DisableStorage   bool `json:"disableStorage"`
+	EnableReturnData bool `json:"enableReturnData"`
+	Limit            int  `json:"limit"` // maximum number of steps recorded, 0 for no limit
+}
+
+// StructLog is one step of a StructLogger trace, in the JSON format of geth's
+// default debug_traceTransaction tracer.
+type StructLog struct {
+	PC         uint64             `json:"pc"`
+	Op         string             `json:"op"`
+	Gas        uint64             `json:"gas"`
+	GasCost    uint64             `json:"gasCost"`
+	Depth      int                `json:"depth"`
+	Error      string             `json:"error,omitempty"`
+	Stack      *[]string          `json:"stack,omitempty"`
+	ReturnData string             `json:"returnData,omitempty"`
+	Memory     *[]string          `json:"memory,omitempty"`
+	Storage    *map[string]string `json:"storage,omitempty"`
+	Refund     uint64             `json:"refund,omitempty"`
+}
+
+// ExecutionTrace is the result of a StructLogger trace.
+type ExecutionTrace struct {
+	Gas         uint64      `json:"gas"`
+	Failed      bool        `json:"failed"`
+	ReturnValue string      `json:"returnValue"`
+	StructLogs  []StructLog `json:"structLogs"`
+}
+
+// StructLogger is a Tracer that records every step of a transaction.
+type StructLogger struct {
+	cfg     LogConfig
+	logs    []StructLog
+	storage map[common.Address]map[common.Hash]common.Hash
+	depth   int
+	gasUsed uint64
+	output  []byte
+	err     error
+}
+
+var _ Tracer = (*StructLogger)(nil)
+
+// NewStructLogger creates a StructLogger recording what cfg selects. cfg may be nil.
+func NewStructLogger(cfg *LogConfig) *StructLogger {
+	logger := &StructLogger{
+		logs:    []StructLog{},
+		storage: make(map[common.Address]map[common.Hash]common.Hash),
+	}
+	if cfg != nil {
+		logger.cfg = *cfg
+	}
+	return logger
+}
+
+func (l *StructLogger) CaptureTxStart(gasLimit uint64) {}
+
+func (l *StructLogger) CaptureTxEnd(gasUsed uint64) {
+	l.gasUsed = gasUsed
+}
+
+func (l *StructLogger) CaptureEnter(typ string, from, to common.Address, input []byte, gas uint64, value *uint256.Int) {
+	l.depth++
+}
+
+func (l *StructLogger) CaptureExit(output []byte, gasUsed uint64, err error) {
+	l.depth--
+	if l.depth == 0 {
+		l.output = output
+		l.err = err
+	}
+}
+
+func (l *StructLogger) CaptureState(step *Step, err error) {
+	if l.cfg.Limit > 0 && len(l.logs) >= l.cfg.Limit {
+		return
+	}
+	entry := StructLog{
+		PC:      step.PC,
+		Op:      step.OpName(),
+		Gas:     step.Gas,
+		GasCost: step.Cost,
+		Depth:   step.Depth,
+		Refund:  step.Refund,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if !l.cfg.DisableStack {
+		stack := make([]string, len(step.Stack))
+		for i := range step.Stack {
+			stack[i] = step.Stack[i].Hex()
+		}
+		entry.Stack = &stack
+	}
+	if l.cfg.EnableMemory {
+		memory := make([]string, 0, len(step.Memory)/32)
+		for i := 0; i+32 <= len(step.Memory); i += 32 {
+			memory = append(memory, hex.EncodeToString(step.Memory[i:i+32]))
+		}
+		entry.Memory = &memory
+	}
+	if l.cfg.EnableReturnData && len(step.ReturnData) > 0 {
+		entry.ReturnData = hexutil.Encode(step.ReturnData)
+	}
+
+	// Like geth, only SLOAD and SSTORE show the contract's storage: every
+	// slot accessed so far, with its latest value
+	if !l.cfg.DisableStorage && step.Storage != nil {
+		slots, ok := l.storage[step.Address]
+		if !ok {
+			slots = make(map[common.Hash]common.Hash)
+			l.storage[step.Address] = slots
+		}
+		slots[step.Storage.Key] = step.Storage.Value
+		storage := make(map[string]string, len(slots))
+		for key, value := range slots {
+			storage[hex.EncodeToString(key[:])] = hex.EncodeToString(value[:])
+		}
+		entry.Storage = &storage
+	}
+	l.logs = append(l.logs, entry)
+}
+
+// StepConfig selects the parts of the frame that cfg records. Once the step
+// limit is reached nothing more is recorded, so nothing is selected.
+func (l *StructLogger) StepConfig() StepConfig {
+	if l.cfg.Limit > 0 && len(l.logs) >= l.cfg.Limit {
+		return StepConfig{}
+	}
+	return StepConfig{
+		Stack:      !l.cfg.DisableStack,
+		Memory:     l.cfg.EnableMemory,
+		ReturnData: l.cfg.EnableReturnData,
+	}
+}
+
+// Result returns the trace recorded so far.
+func (l *StructLogger) Result() *ExecutionTrace {
+	return &ExecutionTrace{
+		Gas:         l.gasUsed,
+		Failed:      l.err != nil,
+		ReturnValue: hex.EncodeToString(l.output),
+		StructLogs:  l.logs,
+	}
+}
@@ -0,0 +1,124 @@
+package contracts
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/uint256"
+)
+
+// Tracer receives the events of a transaction as it executes. Set it on
+// VMExecutionEnvironment.Tracer to follow a call step by step; nested frames
+// report to the same tracer. For every transaction a tracer sees
+// CaptureTxStart, then one CaptureEnter/CaptureExit pair per frame, the
+// outermost included, with the frame's steps in between, and finally
+// CaptureTxEnd.
+type Tracer interface {
+	// CaptureTxStart is called once the intrinsic gas has been charged.
+	CaptureTxStart(gasLimit uint64)
+	// CaptureTxEnd reports the gas used by the whole transaction, refunds
+	// and intrinsic gas included.
+	CaptureTxEnd(gasUsed uint64)
+	// CaptureEnter is called when a frame starts running. typ is the name of
+	// the opcode that created it, CALL or CREATE for the outermost frame.
+	// value is nil for STATICCALL.
+	CaptureEnter(typ string, from, to common.Address, input []byte, gas uint64, value *uint256.Int)
+	// CaptureExit is called when a frame returns, reverts or fails. output
+	// is the returned or reverted data.
+	CaptureExit(output []byte, gasUsed uint64, err error)
+	// CaptureState is called after each instruction, or once a sub-call's
+	// gas has been charged for CALL-family and CREATE opcodes. err is set if
+	// the instruction failed; REVERT is not treated as a failure here.
+	CaptureState(step *Step, err error)
+	// StepConfig selects the parts of the frame's state that steps carry.
+	// Copying them at every instruction is costly, so a step only holds
+	// what the tracer uses.
+	StepConfig() StepConfig
+}
+
+// StepConfig selects the parts of the frame's state a Tracer's steps carry.
+type StepConfig struct {
+	Stack      bool
+	Memory     bool
+	ReturnData bool
+}
+
+// Step describes one executed instruction. Stack, Memory, ReturnData and
+// Refund hold the frame's state before the instruction ran, the first three
+// only if the tracer's StepConfig selects them; a tracer may keep them, as
+// they are copies.
+type Step struct {
+	PC         uint64
+	Op         byte
+	Gas        uint64 // gas left before the instruction
+	Cost       uint64 // gas charged by the instruction
+	Depth      int    // 1 for the outermost frame
+	Address    common.Address
+	Stack      []uint256.Int
+	Memory     []byte
+	ReturnData []byte
+	Refund     uint64
+	Storage    *StorageDiff // slot read by SLOAD or written by SSTORE
+}
+
+// StorageDiff records a storage slot accessed by a step. Prev and Value are
+// equal for SLOAD.
+type StorageDiff struct {
+	Key   common.Hash
+	Prev  common.Hash
+	Value common.Hash
+}
+
+// OpName returns the mnemonic of the step's opcode.
+func (s *Step) OpName() string {
+	return OpName(s.Op)
+}
+
+// String returns the name of the opcode that makes this kind of call.
+func (k callKind) String() string {
+	switch k {
+	case callKindCallCode:
+		return "CALLCODE"
+	case callKindDelegateCall:
+		return "DELEGATECALL"
+	case callKindStaticCall:
+		return "STATICCALL"
+	default:
+		return "CALL"
+	}
+}
+
+// captureStep starts recording the instruction at pc for the tracer, copying
+// the parts of the frame the tracer selects.
+func (env *VMExecutionEnvironment) captureStep(pc int, op byte) {
+	step := &Step{
+		PC:      uint64(pc),
+		Op:      op,
+		Gas:     env.Gas,
+		Depth:   env.depth + 1,
+		Address: env.Context.Address,
+		Refund:  env.State.GetRefund(),
+	}
+	config := env.Tracer.StepConfig()
+	if config.Stack {
+		step.Stack = append([]uint256.Int(nil), env.Stack...)
+	}
+	if config.Memory {
+		step.Memory = append([]byte(nil), env.Memory...)
+	}
+	if config.ReturnData {
+		step.ReturnData = append([]byte(nil), env.returnData...)
+	}
+	env.step = step
+}
+
+// traceStep hands the instruction being recorded to the tracer, charging it
+// with the gas used since captureStep. Instructions that start a sub-call
+// call it before the callee runs, so that the steps stay in execution order.
+func (env *VMExecutionEnvironment) traceStep(err error) {
+	step := env.step
+	if step == nil {
+		return
+	}
+	env.step = nil
+	step.Cost = step.Gas - env.Gas
+	env.Tracer.CaptureState(step, err)
+}
@@ -0,0 +1,59 @@
+package contracts
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/uint256"
+)
+
+// stepRecorder is a Tracer that keeps the steps it is given.
+type stepRecorder struct {
+	config StepConfig
+	steps  []*Step
+}
+
+func (r *stepRecorder) CaptureTxStart(gasLimit uint64) {}
+func (r *stepRecorder) CaptureTxEnd(gasUsed uint64)    {}
+func (r *stepRecorder) CaptureEnter(typ string, from, to common.Address, input []byte, gas uint64, value *uint256.Int) {
+}
+func (r *stepRecorder) CaptureExit(output []byte, gasUsed uint64, err error) {}
+func (r *stepRecorder) CaptureState(step *Step, err error)                   { r.steps = append(r.steps, step) }
+func (r *stepRecorder) StepConfig() StepConfig                               { return r.config }
+
+// TestStepConfig checks that steps carry only the parts of the frame the
+// tracer selects.
+func TestStepConfig(t *testing.T) {
+	// PUSH1 1, PUSH0, MSTORE, STOP: the STOP step sees a word in memory
+	code := []byte{0x60, 0x01, 0x5f, 0x52, 0x00}
+	tests := []struct {
+		name   string
+		config StepConfig
+	}{
+		{"none", StepConfig{}},
+		{"stack", StepConfig{Stack: true}},
+		{"memory", StepConfig{Memory: true}},
+		{"all", StepConfig{Stack: true, Memory: true, ReturnData: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &stepRecorder{config: tt.config}
+			env := newTestEnv(nil)
+			env.Tracer = recorder
+			if _, err := env.ExecuteInput(code, nil); err != nil {
+				t.Fatalf("execution failed: %v", err)
+			}
+			if len(recorder.steps) != 4 {
+				t.Fatalf("%d steps, want 4", len(recorder.steps))
+			}
+
+			// MSTORE runs with two words on the stack, STOP with 32 bytes of memory
+			if got := recorder.steps[2].Stack != nil; got != tt.config.Stack {
+				t.Errorf("stack captured %v, want %v", got, tt.config.Stack)
+			}
+			if got := recorder.steps[3].Memory != nil; got != tt.config.Memory {
+				t.Errorf("memory captured %v, want %v", got, tt.config.Memory)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+// Package disasm renders EVM bytecode as readable instructions and maps them
+// back to Solidity source through the source maps emitted by solc.
+package disasm
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"smartley-contracts/contracts"
+)
+
+// Instruction is one decoded instruction of a contract's code.
+type Instruction struct {
+	PC   uint64
+	Op   byte
+	Arg  []byte // immediate data of a PUSH, possibly cut short by the end of the code
+	Size int    // bytes the instruction declares, immediate data included
+}
+
+// Name returns the instruction's mnemonic, as the VM names it.
+func (i Instruction) Name() string {
+	return contracts.OpName(i.Op)
+}
+
+// Truncated reports whether the code ends before the instruction's immediate data does.
+func (i Instruction) Truncated() bool {
+	return 1+len(i.Arg) < i.Size
+}
+
+// String renders the instruction as assembly, such as "PUSH1 0x80".
+func (i Instruction) String() string {
+	if pushSize(i.Op) == 0 {
+		return i.Name()
+	}
+	return i.Name() + " 0x" + hex.EncodeToString(i.Arg)
+}
+
+// Disassemble decodes code into instructions. Bytes that are not defined
+// opcodes decode as single-byte instructions, as the EVM treats them.
+func Disassemble(code []byte) []Instruction {
+	var instructions []Instruction
+	for pc := 0; pc < len(code); {
+		op := code[pc]
+		size := 1 + pushSize(op)
+		end := pc + size
+		if end > len(code) {
+			end = len(code)
+		}
+		instructions = append(instructions, Instruction{
+			PC:   uint64(pc),
+			Op:   op,
+			Arg:  code[pc+1 : end],
+			Size: size,
+		})
+		pc += size
+	}
+	return instructions
+}
+
+// InstructionIndex returns the position in Disassemble(code) of the
+// instruction starting at pc, which is how solc source maps are indexed.
+func InstructionIndex(code []byte, pc uint64) (int, bool) {
+	for i, ins := range Disassemble(code) {
+		if ins.PC == pc {
+			return i, true
+		}
+		if ins.PC > pc {
+			break
+		}
+	}
+	return 0, false
+}
+
+// Format renders code as an annotated listing, one instruction per line with
+// its pc. Jump destinations and the pushes feeding a jump are labelled. When
+// sourceMap and sources are given, the first instruction compiled from each
+// Solidity location is annotated with it and the source line. The CBOR
+// metadata solc appends to runtime code is shown as data rather than decoded
+// as instructions.
+func Format(code []byte, sourceMap SourceMap, sources []Source) string {
+	code, metadata := SplitMetadata(code)
+	instructions := Disassemble(code)
+
+	var b strings.Builder
+	var lastLocation string
+	for i, ins := range instructions {
+		line := fmt.Sprintf("%06x: %s", ins.PC, ins)
+		var notes []string
+		if ins.Op == 0x5b { // JUMPDEST
+			notes = append(notes, "jump destination")
+		}
+		if ins.Truncated() {
+			notes = append(notes, "truncated")
+		}
+		if i+1 < len(instructions) && pushSize(ins.Op) > 0 && isJump(instructions[i+1].Op) {
+			notes = append(notes, "jump target")
+		}
+		if i < len(sourceMap) {
+			if loc, err := sourceMap[i].Locate(sources); err == nil && loc.String() != lastLocation {
+				lastLocation = loc.String()
+				notes = append(notes, lastLocation+" "+loc.Snippet)
+			}
+		}
+		if len(notes) > 0 {
+			line = fmt.Sprintf("%-40s ; %s", line, strings.Join(notes, ", "))
+		}
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	if len(metadata) > 0 {
+		fmt.Fprintf(&b, "%06x: metadata 0x%s\n", len(code), hex.EncodeToString(metadata))
+	}
+	return b.String()
+}
+
+// SplitMetadata separates the CBOR-encoded metadata solc appends to runtime
+// code, recognised by the big-endian length in its last two bytes, from the
+// code itself. Code without metadata is returned unchanged.
+func SplitMetadata(code []byte) ([]byte, []byte) {
+	if len(code) < 2 {
+		return code, nil
+	}
+	length := int(code[len(code)-2])<<8 | int(code[len(code)-1])
+	start := len(code) - 2 - length
+	if length == 0 || start < 0 {
+		return code, nil
+	}
+	// The metadata is a CBOR map with one to five entries
+	if code[start] < 0xa1 || code[start] > 0xa5 {
+		return code, nil
+	}
+	return code[:start], code[start:]
+}
+
+// isJump reports whether op is JUMP or JUMPI.
+func isJump(op byte) bool {
+	return op == 0x56 || op == 0x57
+}
+
+// pushSize returns the number of immediate bytes that follow op.
+func pushSize(op byte) int {
+	if op >= 0x60 && op <= 0x7f { // PUSH1 ... PUSH32
+		return int(op - 0x5f)
+	}
+	return 0
+}
@@ -0,0 +1,122 @@
+package disasm
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrNoSource is returned when an instruction has no location in the given
+// sources, as is the case for code the compiler generated on its own.
+var ErrNoSource = errors.New("no source location")
+
+// Source is one of the files a contract was compiled from, in the order solc
+// numbered them.
+type Source struct {
+	Name    string
+	Content string
+}
+
+// SourceRange is one entry of a solc source map: the byte range in a source
+// file that an instruction was compiled from.
+type SourceRange struct {
+	Start         int
+	Length        int
+	File          int  // index into the compiled sources, -1 for generated code
+	Jump          byte // 'i' into a function, 'o' out of one, '-' for neither
+	ModifierDepth int
+}
+
+// SourceMap maps each instruction of a contract's code, by position in the
+// output of Disassemble, to the source it was compiled from.
+type SourceMap []SourceRange
+
+// ParseSourceMap decodes a solc source map, such as evm.deployedBytecode.sourceMap.
+// Entries are "s:l:f:j:m" separated by semicolons, where an empty field
+// repeats the value of the entry before.
+func ParseSourceMap(s string) (SourceMap, error) {
+	if s == "" {
+		return nil, nil
+	}
+	entries := strings.Split(s, ";")
+	sourceMap := make(SourceMap, 0, len(entries))
+	prev := SourceRange{File: -1, Jump: '-'}
+	for i, entry := range entries {
+		current := prev
+		for field, value := range strings.Split(entry, ":") {
+			if value == "" {
+				continue
+			}
+			if field == 3 {
+				current.Jump = value[0]
+				continue
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid source map entry %d %q: %v", i, entry, err)
+			}
+			switch field {
+			case 0:
+				current.Start = n
+			case 1:
+				current.Length = n
+			case 2:
+				current.File = n
+			case 4:
+				current.ModifierDepth = n
+			}
+		}
+		sourceMap = append(sourceMap, current)
+		prev = current
+	}
+	return sourceMap, nil
+}
+
+// Location is a position in a Solidity source file. Line and Column count from 1.
+type Location struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Snippet string `json:"snippet"` // the source line holding the location
+}
+
+func (l *Location) String() string {
+	return fmt.Sprintf("%s:%d:%d", l.File, l.Line, l.Column)
+}
+
+// Locate returns the position in sources that r starts at.
+func (r SourceRange) Locate(sources []Source) (*Location, error) {
+	if r.File < 0 || r.File >= len(sources) {
+		return nil, ErrNoSource
+	}
+	source := sources[r.File]
+	if r.Start > len(source.Content) {
+		return nil, fmt.Errorf("source offset %d is beyond the end of %s", r.Start, source.Name)
+	}
+	before := source.Content[:r.Start]
+	lineStart := strings.LastIndexByte(before, '\n') + 1
+	lineEnd := strings.IndexByte(source.Content[lineStart:], '\n')
+	if lineEnd < 0 {
+		lineEnd = len(source.Content) - lineStart
+	}
+	return &Location{
+		File:    source.Name,
+		Line:    strings.Count(before, "\n") + 1,
+		Column:  r.Start - lineStart + 1,
+		Snippet: strings.TrimSpace(source.Content[lineStart : lineStart+lineEnd]),
+	}, nil
+}
+
+// Locate returns the source position of the instruction at pc in code, the
+// code the source map was generated for.
+func (m SourceMap) Locate(code []byte, pc uint64, sources []Source) (*Location, error) {
+	index, ok := InstructionIndex(code, pc)
+	if !ok {
+		return nil, fmt.Errorf("no instruction starts at pc %d", pc)
+	}
+	if index >= len(m) {
+		return nil, ErrNoSource
+	}
+	return m[index].Locate(sources)
+}
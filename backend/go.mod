@@ -4,6 +4,8 @@ go 1.20
 
 require (
 	github.com/asdine/storm v2.1.2+incompatible
+	github.com/ethereum/go-ethereum v1.12.0
+	github.com/holiman/uint256 v1.2.2-0.20230321075855-87b91420868c
 	github.com/nmvalera/solc-go v0.0.0-20200220073937-8792f0be3799
 	github.com/rs/cors v1.9.0
 	github.com/sirupsen/logrus v1.9.3
@@ -13,10 +15,8 @@ require (
 	github.com/Sereal/Sereal/Go/sereal v0.0.0-20230419130644-dca84cd9f196 // indirect
 	github.com/btcsuite/btcd/btcec/v2 v2.2.0 // indirect
 	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.0.1 // indirect
-	github.com/ethereum/go-ethereum v1.12.0 // indirect
 	github.com/golang/protobuf v1.5.2 // indirect
 	github.com/golang/snappy v0.0.5-0.20220116011046-fa5810519dcb // indirect
-	github.com/holiman/uint256 v1.2.2-0.20230321075855-87b91420868c // indirect
 	github.com/stretchr/testify v1.8.3 // indirect
 	github.com/vmihailenco/msgpack v4.0.4+incompatible // indirect
 	golang.org/x/net v0.10.0 // indirect
@@ -1,14 +1,50 @@
 package main
 
 import (
+	"flag"
 	"log"
+	"os"
 	"smartley-contracts/api"
 	"smartley-contracts/blockchain"
 	"smartley-contracts/contracts"
 	"smartley-contracts/storage"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		validateCommand(os.Args[2:])
+		return
+	}
+
+	config := blockchain.DefaultConfig()
+	genesis := flag.String("genesis", "", "JSON file mapping addresses to the balances, in wei, they start with")
+	coinbase := flag.String("coinbase", "", "address named as the miner of new blocks, the zero address by default")
+	flag.DurationVar(&config.BlockInterval, "block-interval", config.BlockInterval, "time between blocks that the difficulty adjusts towards")
+	flag.StringVar(&api.AdminToken, "admin-token", os.Getenv("ADMIN_TOKEN"), "bearer token the /admin endpoints require, $ADMIN_TOKEN by default; they are disabled without one")
+	flag.Parse()
+
+	// Block timestamps are in whole seconds
+	if config.BlockInterval < time.Second {
+		log.Fatalf("Block interval %v is under a second", config.BlockInterval)
+	}
+	if *coinbase != "" {
+		if !common.IsHexAddress(*coinbase) {
+			log.Fatalf("Invalid coinbase address %q", *coinbase)
+		}
+		config.Coinbase = common.HexToAddress(*coinbase)
+	}
+	if *genesis != "" {
+		alloc, err := blockchain.LoadGenesisAlloc(*genesis)
+		if err != nil {
+			log.Fatalf("Error loading genesis allocation: %v", err)
+		}
+		config.GenesisAlloc = alloc
+	}
+
 	api.ExecutionEnvironments = make(map[string]*contracts.VMExecutionEnvironment)
 
 	// Initialize the storage
@@ -17,7 +53,7 @@ func main() {
 
 	initBlockchain()
 
-	api.Start()
+	api.Start(config)
 }
 
 func initBlockchain() {
@@ -26,11 +62,20 @@ func initBlockchain() {
 	log.Println("Blockchain initialized")
 
 	log.Println("Adding sample transaction...")
-	bc.AddTransaction(&blockchain.Transaction{
-		Sender:    "Alice",
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		log.Fatalf("Error generating sample key: %v", err)
+	}
+	tx := &blockchain.Transaction{
 		Recipient: "Bob",
 		Payload:   "Sample transaction",
-	})
+	}
+	if err := blockchain.SignTransaction(tx, key); err != nil {
+		log.Fatalf("Error signing sample transaction: %v", err)
+	}
+	if err := bc.AddTransaction(tx); err != nil {
+		log.Fatalf("Error adding sample transaction: %v", err)
+	}
 	log.Println("Sample transaction added")
 
 	log.Println("Mining a new block...")
@@ -0,0 +1,124 @@
+// Package merkle computes the binary Merkle trees blocks use to commit to
+// their transactions, receipts and state, and proofs that an item is part of
+// such a tree.
+//
+// The tree follows RFC 6962 with Keccak-256: leaves and interior nodes are
+// hashed with distinct prefixes, so that a leaf can never be passed off as a
+// node, and a list of n items is split at the largest power of two below n
+// rather than padded.
+package merkle
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	leafPrefix = 0x00
+	nodePrefix = 0x01
+)
+
+// EmptyRoot is the root of a tree with no leaves.
+var EmptyRoot = crypto.Keccak256Hash(nil)
+
+// Root returns the root of the tree whose leaves are items, in order.
+func Root(items [][]byte) common.Hash {
+	if len(items) == 0 {
+		return EmptyRoot
+	}
+	hashes := make([]common.Hash, len(items))
+	for i, item := range items {
+		hashes[i] = LeafHash(item)
+	}
+	return root(hashes)
+}
+
+// LeafHash returns the hash of the leaf holding item.
+func LeafHash(item []byte) common.Hash {
+	return crypto.Keccak256Hash([]byte{leafPrefix}, item)
+}
+
+// nodeHash returns the hash of the interior node with the given children.
+func nodeHash(left, right common.Hash) common.Hash {
+	return crypto.Keccak256Hash([]byte{nodePrefix}, left[:], right[:])
+}
+
+// root returns the root of the tree over the given leaf hashes.
+func root(leaves []common.Hash) common.Hash {
+	if len(leaves) == 1 {
+		return leaves[0]
+	}
+	k := split(len(leaves))
+	return nodeHash(root(leaves[:k]), root(leaves[k:]))
+}
+
+// split returns the largest power of two less than n, which is where the
+// leaves of a tree with n > 1 leaves divide between its two subtrees.
+func split(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+// Proof is the audit path proving that a leaf is part of a tree: the roots of
+// the sibling subtrees met on the way from the leaf up to the root.
+type Proof struct {
+	Index int           `json:"index"` // Position of the leaf
+	Size  int           `json:"size"`  // Number of leaves in the tree
+	Path  []common.Hash `json:"path"`  // Sibling hashes, from the leaf's up
+}
+
+// Prove returns the proof that items[index] is part of the tree over items.
+func Prove(items [][]byte, index int) (*Proof, error) {
+	if index < 0 || index >= len(items) {
+		return nil, fmt.Errorf("leaf %d out of range for %d items", index, len(items))
+	}
+	hashes := make([]common.Hash, len(items))
+	for i, item := range items {
+		hashes[i] = LeafHash(item)
+	}
+	return &Proof{Index: index, Size: len(items), Path: path(index, hashes)}, nil
+}
+
+// path returns the audit path of the m-th of the given leaf hashes.
+func path(m int, leaves []common.Hash) []common.Hash {
+	if len(leaves) == 1 {
+		return nil
+	}
+	k := split(len(leaves))
+	if m < k {
+		return append(path(m, leaves[:k]), root(leaves[k:]))
+	}
+	return append(path(m-k, leaves[k:]), root(leaves[:k]))
+}
+
+// Verify reports whether proof shows item to be part of the tree with the
+// given root, using the verification algorithm of RFC 9162.
+func Verify(root common.Hash, item []byte, proof *Proof) bool {
+	if proof.Index < 0 || proof.Index >= proof.Size {
+		return false
+	}
+	fn, sn := proof.Index, proof.Size-1
+	r := LeafHash(item)
+	for _, p := range proof.Path {
+		if sn == 0 {
+			return false
+		}
+		if fn&1 == 1 || fn == sn {
+			r = nodeHash(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = nodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	return sn == 0 && r == root
+}
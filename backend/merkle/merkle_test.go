@@ -0,0 +1,121 @@
+package merkle
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// testItems returns n distinct items.
+func testItems(n int) [][]byte {
+	items := make([][]byte, n)
+	for i := range items {
+		items[i] = []byte(fmt.Sprintf("item %d", i))
+	}
+	return items
+}
+
+// TestRootShape checks that trees split at the largest power of two below
+// their size, as RFC 6962 lays them out.
+func TestRootShape(t *testing.T) {
+	items := testItems(5)
+	l := make([]common.Hash, len(items))
+	for i, item := range items {
+		l[i] = LeafHash(item)
+	}
+	tests := []struct {
+		n    int
+		want common.Hash
+	}{
+		{0, EmptyRoot},
+		{1, l[0]},
+		{2, nodeHash(l[0], l[1])},
+		{3, nodeHash(nodeHash(l[0], l[1]), l[2])},
+		{5, nodeHash(nodeHash(nodeHash(l[0], l[1]), nodeHash(l[2], l[3])), l[4])},
+	}
+	for _, tt := range tests {
+		if got := Root(items[:tt.n]); got != tt.want {
+			t.Errorf("root of %d items %s, want %s", tt.n, got.Hex(), tt.want.Hex())
+		}
+	}
+}
+
+// TestProveVerify proves every item of trees of many shapes.
+func TestProveVerify(t *testing.T) {
+	for n := 1; n <= 33; n++ {
+		items := testItems(n)
+		root := Root(items)
+		for i := range items {
+			proof, err := Prove(items, i)
+			if err != nil {
+				t.Fatalf("proving item %d of %d: %v", i, n, err)
+			}
+			if !Verify(root, items[i], proof) {
+				t.Errorf("proof of item %d of %d rejected", i, n)
+			}
+		}
+	}
+}
+
+// TestVerifyRejectsBadProofs alters a valid proof in every way a forger could.
+func TestVerifyRejectsBadProofs(t *testing.T) {
+	items := testItems(11)
+	root := Root(items)
+	const index = 6
+
+	tests := []struct {
+		name   string
+		modify func(root *common.Hash, item *[]byte, proof *Proof)
+	}{
+		{"wrong_item", func(root *common.Hash, item *[]byte, proof *Proof) { *item = items[index+1] }},
+		{"wrong_root", func(root *common.Hash, item *[]byte, proof *Proof) { root[0] ^= 1 }},
+		{"next_index", func(root *common.Hash, item *[]byte, proof *Proof) { proof.Index++ }},
+		{"previous_index", func(root *common.Hash, item *[]byte, proof *Proof) { proof.Index-- }},
+		{"negative_index", func(root *common.Hash, item *[]byte, proof *Proof) { proof.Index = -1 }},
+		{"index_past_size", func(root *common.Hash, item *[]byte, proof *Proof) { proof.Index = proof.Size }},
+		// Sizes for which the path has another shape; sizes 9 to 16 share it,
+		// as the leaf is in the same complete left subtree of eight
+		{"size_of_left_subtree", func(root *common.Hash, item *[]byte, proof *Proof) { proof.Size = 8 }},
+		{"size_ending_at_leaf", func(root *common.Hash, item *[]byte, proof *Proof) { proof.Size = index + 1 }},
+		{"larger_size", func(root *common.Hash, item *[]byte, proof *Proof) { proof.Size = 17 }},
+		{"altered_sibling", func(root *common.Hash, item *[]byte, proof *Proof) { proof.Path[1][31] ^= 1 }},
+		{"swapped_siblings", func(root *common.Hash, item *[]byte, proof *Proof) {
+			proof.Path[0], proof.Path[1] = proof.Path[1], proof.Path[0]
+		}},
+		{"truncated_path", func(root *common.Hash, item *[]byte, proof *Proof) { proof.Path = proof.Path[:len(proof.Path)-1] }},
+		{"extended_path", func(root *common.Hash, item *[]byte, proof *Proof) { proof.Path = append(proof.Path, *root) }},
+		{"empty_path", func(root *common.Hash, item *[]byte, proof *Proof) { proof.Path = nil }},
+		{"leaf_as_node", func(root *common.Hash, item *[]byte, proof *Proof) {
+			// An interior node's children passed off as a leaf's item
+			*item = append(LeafHash(items[index]).Bytes(), proof.Path[0].Bytes()...)
+			proof.Path = proof.Path[1:]
+			proof.Index /= 2
+			proof.Size = (proof.Size + 1) / 2
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proof, err := Prove(items, index)
+			if err != nil {
+				t.Fatal(err)
+			}
+			proof.Path = append([]common.Hash(nil), proof.Path...)
+			root, item := root, items[index]
+			tt.modify(&root, &item, proof)
+			if Verify(root, item, proof) {
+				t.Error("altered proof accepted")
+			}
+		})
+	}
+}
+
+// TestProveOutOfRange checks that only items in the tree can be proven.
+func TestProveOutOfRange(t *testing.T) {
+	items := testItems(3)
+	for _, index := range []int{-1, 3} {
+		if _, err := Prove(items, index); err == nil {
+			t.Errorf("proof of item %d of 3 created", index)
+		}
+	}
+}
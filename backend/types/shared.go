@@ -1,62 +1,195 @@
 package types
 
-type Stack []int64
+import (
+	"errors"
 
-func (s *Stack) Push(value int64) {
-	*s = append(*s, value)
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/uint256"
+)
+
+// StackLimit is the maximum number of words the VM stack may hold.
+const StackLimit = 1024
+
+var (
+	ErrStackUnderflow = errors.New("stack underflow")
+	ErrStackOverflow  = errors.New("stack overflow")
+)
+
+// Stack is the VM operand stack. Every entry is a 256-bit EVM word.
+type Stack []uint256.Int
+
+func (s *Stack) Push(value *uint256.Int) error {
+	if len(*s) >= StackLimit {
+		return ErrStackOverflow
+	}
+	*s = append(*s, *value)
+	return nil
 }
 
-func (s *Stack) Pop() int64 {
+func (s *Stack) Pop() (uint256.Int, error) {
 	length := len(*s)
 	if length == 0 {
-		panic("Cannot pop from an empty stack") // or handle the case as needed
+		return uint256.Int{}, ErrStackUnderflow
 	}
 
 	value := (*s)[length-1]
 	*s = (*s)[:length-1]
-	return value
+	return value, nil
 }
 
 func (s *Stack) Len() int {
 	return len(*s)
 }
 
+// Memory is the byte-addressed, word-expanded VM memory.
 type Memory []byte
 
-type Storage map[string]interface{}
+// Resize grows the memory to size bytes. Memory never shrinks.
+func (m *Memory) Resize(size uint64) {
+	if uint64(len(*m)) < size {
+		*m = append(*m, make([]byte, size-uint64(len(*m)))...)
+	}
+}
 
-func (s Storage) GetABI() []byte {
-	abi, ok := s["abi"]
-	if ok {
-		return abi.([]byte)
+// Set copies value into memory at offset. The memory must already be large enough.
+func (m Memory) Set(offset, size uint64, value []byte) {
+	if size > 0 {
+		copy(m[offset:offset+size], value)
 	}
-	return nil
 }
 
-func (s Storage) SetABI(abi []byte) {
-	s["abi"] = abi
+// Set32 stores value as a big-endian 32-byte word at offset. The memory must
+// already be large enough.
+func (m Memory) Set32(offset uint64, value *uint256.Int) {
+	b32 := value.Bytes32()
+	copy(m[offset:offset+32], b32[:])
+}
+
+// GetCopy returns a copy of size bytes starting at offset.
+func (m Memory) GetCopy(offset, size uint64) []byte {
+	if size == 0 {
+		return nil
+	}
+	cpy := make([]byte, size)
+	copy(cpy, m[offset:offset+size])
+	return cpy
+}
+
+// Storage is an account's persisted state: its balance and nonce and, for
+// contract accounts, its ABI, its code and the 32-byte storage slots written by
+// SSTORE. Externally owned accounts have no code.
+type Storage struct {
+	abi      []byte
+	bytecode []byte
+	balance  uint256.Int // Balance in wei
+	nonce    uint64      // Number of transactions sent, or for contracts, contracts created, by the account
+	slots    map[common.Hash]common.Hash
+}
+
+func NewStorage() *Storage {
+	return &Storage{slots: make(map[common.Hash]common.Hash)}
+}
+
+func (s *Storage) GetABI() []byte {
+	return s.abi
+}
+
+func (s *Storage) SetABI(abi []byte) {
+	s.abi = abi
 }
 
 type ExecutionEnvironment interface {
 	Execute() error
 }
 
-func (s Storage) GetBytecode() []byte {
-	bytecode, ok := s["bytecode"]
-	if ok {
-		return bytecode.([]byte)
+func (s *Storage) GetBytecode() []byte {
+	return s.bytecode
+}
+
+func (s *Storage) SetBytecode(bytecode []byte) {
+	s.bytecode = bytecode
+}
+
+// GetBalance returns the account balance in wei.
+func (s *Storage) GetBalance() *uint256.Int {
+	return new(uint256.Int).Set(&s.balance)
+}
+
+// SetBalance sets the account balance in wei.
+func (s *Storage) SetBalance(balance *uint256.Int) {
+	s.balance.Set(balance)
+}
+
+// GetNonce returns the account nonce.
+func (s *Storage) GetNonce() uint64 {
+	return s.nonce
+}
+
+// SetNonce sets the account nonce.
+func (s *Storage) SetNonce(nonce uint64) {
+	s.nonce = nonce
+}
+
+// GetState returns the value of a storage slot. Slots never written read as zero.
+func (s *Storage) GetState(key common.Hash) common.Hash {
+	return s.slots[key]
+}
+
+// SetState writes a storage slot. Writing zero clears the slot.
+func (s *Storage) SetState(key, value common.Hash) {
+	if value == (common.Hash{}) {
+		delete(s.slots, key)
+		return
 	}
-	return nil
+	s.slots[key] = value
+}
+
+// ForEachState calls fn with every non-zero storage slot, in no particular order.
+func (s *Storage) ForEachState(fn func(key, value common.Hash)) {
+	for key, value := range s.slots {
+		fn(key, value)
+	}
+}
+
+// Copy returns an independent copy of the storage, so that execution can write
+// to it freely and the caller decides whether to keep the result.
+func (s *Storage) Copy() *Storage {
+	cpy := &Storage{
+		abi:      s.abi,
+		bytecode: s.bytecode,
+		balance:  s.balance,
+		nonce:    s.nonce,
+		slots:    make(map[common.Hash]common.Hash, len(s.slots)),
+	}
+	for key, value := range s.slots {
+		cpy.slots[key] = value
+	}
+	return cpy
+}
+
+func (s *Stack) Peek(n int) (*uint256.Int, error) {
+	length := len(*s)
+	if length < n+1 {
+		return nil, ErrStackUnderflow
+	}
+	return &(*s)[length-n-1], nil
 }
 
-func (s Storage) SetBytecode(bytecode []byte) {
-	s["bytecode"] = bytecode
+// Dup pushes a copy of the n-th word from the top, where n is 1 for the top word.
+func (s *Stack) Dup(n int) error {
+	value, err := s.Peek(n - 1)
+	if err != nil {
+		return err
+	}
+	return s.Push(value)
 }
 
-func (s *Stack) Peek(n int) int64 {
+// Swap exchanges the top word with the word n positions below it.
+func (s *Stack) Swap(n int) error {
 	length := len(*s)
 	if length < n+1 {
-		panic("stack underflow")
+		return ErrStackUnderflow
 	}
-	return (*s)[length-n-1]
+	(*s)[length-1], (*s)[length-n-1] = (*s)[length-n-1], (*s)[length-1]
+	return nil
 }
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"smartley-contracts/blockchain"
+)
+
+// validateCommand runs the validate subcommand, which asks a running node to
+// audit its chain and prints the report. The chain lives in the node's memory,
+// so it cannot be validated from outside the node process. It exits with
+// status 1 if the chain is invalid and 2 if the node cannot be asked.
+func validateCommand(args []string) {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	node := flags.String("node", "http://localhost:8080", "URL of the node whose chain to validate")
+	token := flags.String("token", os.Getenv("ADMIN_TOKEN"), "admin token of the node, $ADMIN_TOKEN by default")
+	flags.Parse(args)
+
+	request, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(*node, "/")+"/admin/validate", nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid node URL: %v\n", err)
+		os.Exit(2)
+	}
+	request.Header.Set("Authorization", "Bearer "+*token)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error contacting node: %v\n", err)
+		os.Exit(2)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "Node responded with %s\n", response.Status)
+		os.Exit(2)
+	}
+
+	var report blockchain.ValidationReport
+	if err := json.NewDecoder(response.Body).Decode(&report); err != nil {
+		fmt.Fprintf(os.Stderr, "Error decoding validation report: %v\n", err)
+		os.Exit(2)
+	}
+
+	fmt.Printf("Blocks checked:   %d\n", report.BlocksChecked)
+	fmt.Printf("State root:       %s\n", report.StateRoot.Hex())
+	fmt.Printf("Total difficulty: %v\n", report.TotalDifficulty)
+	if !report.Valid {
+		fmt.Printf("INVALID at block %d (%s): %s\n", report.Failure.BlockIndex, report.Failure.BlockHash, report.Failure.Reason)
+		os.Exit(1)
+	}
+	fmt.Println("Chain is valid")
+}